@@ -0,0 +1,90 @@
+package valloxrs485
+
+import (
+	"fmt"
+	"time"
+)
+
+// Boost activates the fireplace function for duration d by setting
+// Flags6ActivateFireplaceSwitch of RegisterFlags06, and clears it again after
+// d. Calling Boost while a boost is active extends it if the new end time is
+// later. The current Flags06 value must have been received from the bus
+// before calling this. RegisterFlags06 is not writable by default, it must be
+// allowed with Config.WritableRegisters.
+func (vallox *Vallox) Boost(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("invalid boost duration %v", d)
+	}
+	if err := vallox.checkWritable(RegisterFlags06); err != nil {
+		return err
+	}
+
+	vallox.boostMu.Lock()
+	defer vallox.boostMu.Unlock()
+
+	until := vallox.now().Add(d)
+	if vallox.boostTimer != nil {
+		if until.After(vallox.boostUntil) {
+			vallox.logDebug.Debugf("extending boost until %v", until)
+			vallox.boostTimer.Stop()
+			vallox.scheduleBoostEnd(until)
+		}
+		return nil
+	}
+
+	vallox.logDebug.Debugf("activating boost until %v", until)
+	err := vallox.modifyRegister(RegisterFlags06, func(current byte) byte {
+		return current | Flags6ActivateFireplaceSwitch
+	})
+	if err != nil {
+		return err
+	}
+	vallox.scheduleBoostEnd(until)
+	return nil
+}
+
+// CancelBoost ends an active boost immediately
+func (vallox *Vallox) CancelBoost() error {
+	vallox.boostMu.Lock()
+	defer vallox.boostMu.Unlock()
+	if vallox.boostTimer == nil {
+		return nil
+	}
+	vallox.boostTimer.Stop()
+	return vallox.endBoost()
+}
+
+// BoostActive returns true while a boost started with Boost is active
+func (vallox *Vallox) BoostActive() bool {
+	vallox.boostMu.Lock()
+	defer vallox.boostMu.Unlock()
+	return vallox.boostTimer != nil
+}
+
+// scheduleBoostEnd must be called with boostMu held
+func (vallox *Vallox) scheduleBoostEnd(until time.Time) {
+	vallox.boostUntil = until
+	vallox.boostGeneration++
+	generation := vallox.boostGeneration
+	vallox.boostTimer = time.AfterFunc(until.Sub(vallox.now()), func() {
+		vallox.boostMu.Lock()
+		defer vallox.boostMu.Unlock()
+		if generation != vallox.boostGeneration || vallox.boostTimer == nil {
+			// boost was extended or cancelled meanwhile
+			return
+		}
+		if err := vallox.endBoost(); err != nil {
+			vallox.logDebug.Debugf("error ending boost: %v", err)
+		}
+	})
+}
+
+// endBoost must be called with boostMu held
+func (vallox *Vallox) endBoost() error {
+	vallox.boostTimer = nil
+	vallox.boostGeneration++
+	vallox.logDebug.Debugf("ending boost")
+	return vallox.modifyRegister(RegisterFlags06, func(current byte) byte {
+		return current &^ Flags6ActivateFireplaceSwitch
+	})
+}
@@ -0,0 +1,122 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoost(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterFlags06}})
+	if err := v.Boost(time.Second); err == nil {
+		t.Errorf("boost started without known flags06 value")
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterFlags06, Flags6RemoteControl))
+	if err := v.Boost(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterFlags06, Flags6RemoteControl|Flags6ActivateFireplaceSwitch, t)
+	assertWrite(v, MsgPanels, RegisterFlags06, Flags6RemoteControl|Flags6ActivateFireplaceSwitch, t)
+
+	// extend, no new writes expected
+	if err := v.Boost(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.out) != 0 {
+		t.Errorf("extending boost queued %d writes", len(v.out))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !v.BoostActive() {
+		t.Errorf("extended boost ended early")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for v.BoostActive() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if v.BoostActive() {
+		t.Fatal("boost did not end")
+	}
+	assertWrite(v, MsgMainboard1, RegisterFlags06, Flags6RemoteControl, t)
+	assertWrite(v, MsgPanels, RegisterFlags06, Flags6RemoteControl, t)
+}
+
+func TestCancelBoost(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterFlags06}})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterFlags06, 0))
+	if err := v.Boost(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.CancelBoost(); err != nil {
+		t.Fatal(err)
+	}
+	if v.BoostActive() {
+		t.Errorf("boost active after cancel")
+	}
+	if len(v.out) != 4 {
+		t.Errorf("expected 4 writes got %d", len(v.out))
+	}
+}
+
+func TestBoostNotWritableByDefault(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterFlags06, 0))
+	if err := v.Boost(time.Hour); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+	if v.BoostActive() {
+		t.Errorf("boost active without write")
+	}
+}
+
+func TestBoostUsesWrittenFlags(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterFlags06}})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterFlags06, 0))
+	if err := v.Boost(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// another change of flags06 before the mainboard reports the boost
+	err := v.modifyRegister(RegisterFlags06, func(current byte) byte {
+		return current | Flags6RemoteControl
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.CancelBoost(); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterFlags06, Flags6ActivateFireplaceSwitch, t)
+	assertWrite(v, MsgPanels, RegisterFlags06, Flags6ActivateFireplaceSwitch, t)
+	assertWrite(v, MsgMainboard1, RegisterFlags06, Flags6ActivateFireplaceSwitch|Flags6RemoteControl, t)
+	assertWrite(v, MsgPanels, RegisterFlags06, Flags6ActivateFireplaceSwitch|Flags6RemoteControl, t)
+	assertWrite(v, MsgMainboard1, RegisterFlags06, Flags6RemoteControl, t)
+	assertWrite(v, MsgPanels, RegisterFlags06, Flags6RemoteControl, t)
+}
+
+func TestBoostClock(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterFlags06}})
+	clock := newFakeClock(v)
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterFlags06, 0))
+	if err := v.Boost(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer v.CancelBoost()
+	v.boostMu.Lock()
+	until := v.boostUntil
+	v.boostMu.Unlock()
+	if expected := clock.Now().Add(time.Hour); !until.Equal(expected) {
+		t.Errorf("expected boost until %v got %v", expected, until)
+	}
+
+	// an extension is compared against the same clock
+	clock.Advance(30 * time.Minute)
+	if err := v.Boost(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	v.boostMu.Lock()
+	until = v.boostUntil
+	v.boostMu.Unlock()
+	if expected := clock.Now().Add(time.Hour); !until.Equal(expected) {
+		t.Errorf("expected extended boost until %v got %v", expected, until)
+	}
+}
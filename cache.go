@@ -0,0 +1,172 @@
+package valloxrs485
+
+// Get returns the latest event received for register
+func (vallox *Vallox) Get(register byte) (Event, bool) {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	e, ok := vallox.cache[register]
+	return e, ok
+}
+
+// Snapshot returns a copy of the latest events received for each register
+func (vallox *Vallox) Snapshot() map[byte]Event {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	snapshot := make(map[byte]Event, len(vallox.cache))
+	for register, e := range vallox.cache {
+		snapshot[register] = e
+	}
+	return snapshot
+}
+
+// OutdoorTemp returns the latest outdoor temperature, not ok if the sensor is faulty
+func (vallox *Vallox) OutdoorTemp() (int8, bool) {
+	return vallox.cachedTemp(RegisterOutdoorTemp)
+}
+
+// SupplyTemp returns the latest supply air temperature, not ok if the sensor is faulty
+func (vallox *Vallox) SupplyTemp() (int8, bool) {
+	return vallox.cachedTemp(RegisterSupplyTemp)
+}
+
+// ExhaustInTemp returns the latest temperature of exhaust air coming in from
+// the house, not ok if the sensor is faulty
+func (vallox *Vallox) ExhaustInTemp() (int8, bool) {
+	return vallox.cachedTemp(RegisterExhaustInTemp)
+}
+
+// ExhaustOutTemp returns the latest temperature of exhaust air going outside,
+// not ok if the sensor is faulty
+func (vallox *Vallox) ExhaustOutTemp() (int8, bool) {
+	return vallox.cachedTemp(RegisterExhaustOutTemp)
+}
+
+// PostHeatingTarget returns the latest supply air temperature the post-heating
+// is currently heating to, as computed by the mainboard
+func (vallox *Vallox) PostHeatingTarget() (int8, bool) {
+	return vallox.cachedSetting(RegisterPostHeatingTarget)
+}
+
+// PostHeatingSetpoint returns the latest configured post-heating setpoint
+func (vallox *Vallox) PostHeatingSetpoint() (int8, bool) {
+	return vallox.cachedSetting(RegisterPostHeatingSetpoint)
+}
+
+// CurrentFanSpeed returns the latest fan speed 1-8
+func (vallox *Vallox) CurrentFanSpeed() (int, bool) {
+	raw, ok := vallox.cachedValue(RegisterCurrentFanSpeed)
+	if !ok {
+		return 0, false
+	}
+	speed := decodeFanSpeed(raw)
+	return int(speed), speed.IsValid()
+}
+
+// RH1 returns the latest relative humidity of sensor 1
+func (vallox *Vallox) RH1() (float64, bool) {
+	return vallox.cachedRH(RegisterRH1)
+}
+
+// RH2 returns the latest relative humidity of sensor 2
+func (vallox *Vallox) RH2() (float64, bool) {
+	return vallox.cachedRH(RegisterRH2)
+}
+
+// CurrentCO2 returns the latest CO2 concentration in ppm. The value is sent as
+// two registers, RegisterCurrentCO2 holds the high byte and RegisterMaximumCO2
+// the low byte. The bytes are updated separately so a reading taken between
+// the two updates may combine an old and a new byte.
+func (vallox *Vallox) CurrentCO2() (uint16, bool) {
+	high, ok := vallox.cachedValue(RegisterCurrentCO2)
+	if !ok {
+		return 0, false
+	}
+	low, ok := vallox.cachedValue(RegisterMaximumCO2)
+	if !ok {
+		return 0, false
+	}
+	return decodeCO2(high, low), true
+}
+
+// ServiceInterval returns the latest interval of the filter change reminder in months
+func (vallox *Vallox) ServiceInterval() (int, bool) {
+	raw, ok := vallox.cachedValue(RegisterServiceInterval)
+	return int(raw), ok
+}
+
+// MaximumSpeedLimitEnabled returns the latest maximum speed limit flag of
+// RegisterProgram2
+func (vallox *Vallox) MaximumSpeedLimitEnabled() (bool, bool) {
+	raw, ok := vallox.cachedValue(RegisterProgram2)
+	if !ok {
+		return false, false
+	}
+	return decodeProgram2(raw).MaximumSpeedLimit, true
+}
+
+// Status returns the latest status flags
+func (vallox *Vallox) Status() (StatusFlags, bool) {
+	raw, ok := vallox.cachedValue(RegisterStatus)
+	if !ok {
+		return StatusFlags{}, false
+	}
+	return decodeStatus(raw), true
+}
+
+func (vallox *Vallox) cachedRaw(register byte) (byte, bool) {
+	e, ok := vallox.Get(register)
+	return e.RawValue, ok
+}
+
+// cachedValue returns the cached raw value of register for the typed
+// accessors, not ok if Config.Decoders replaces the decoding of register
+func (vallox *Vallox) cachedValue(register byte) (byte, bool) {
+	if _, ok := vallox.decoders[register]; ok {
+		return 0, false
+	}
+	return vallox.cachedRaw(register)
+}
+
+func (vallox *Vallox) cachedTemp(register byte) (int8, bool) {
+	raw, ok := vallox.cachedValue(register)
+	if !ok {
+		return 0, false
+	}
+	return valueToTemp(raw), !vallox.IsSensorFault(register)
+}
+
+// cachedSetting returns a temperature that is not a sensor reading, so it has
+// no fault values
+func (vallox *Vallox) cachedSetting(register byte) (int8, bool) {
+	raw, ok := vallox.cachedValue(register)
+	if !ok {
+		return 0, false
+	}
+	return valueToTemp(raw), true
+}
+
+func (vallox *Vallox) cachedRH(register byte) (float64, bool) {
+	raw, ok := vallox.cachedValue(register)
+	if !ok {
+		return 0, false
+	}
+	return decodeRh(raw), true
+}
+
+func updateCache(vallox *Vallox, e *Event) {
+	if e.Register == 0 {
+		// queries do not carry a register value
+		return
+	}
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	vallox.cache[e.Register] = *e
+	if fromMainboard(*e) {
+		// the mainboard has the latest value again, see modifyRegister
+		delete(vallox.written, e.Register)
+	}
+}
+
+func decodeCO2(high byte, low byte) uint16 {
+	return uint16(high)<<8 | uint16(low)
+}
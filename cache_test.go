@@ -0,0 +1,107 @@
+package valloxrs485
+
+import (
+	"testing"
+)
+
+func TestTypedAccessors(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	if _, ok := v.OutdoorTemp(); ok {
+		t.Errorf("outdoor temp known before any events")
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed3))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterStatus, StatusFlagPower|StatusFlagFilter))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterServiceInterval, 4))
+
+	if temp, ok := v.OutdoorTemp(); !ok || temp != 0 {
+		t.Errorf("expected outdoor temp 0 got %d %v", temp, ok)
+	}
+	if speed, ok := v.CurrentFanSpeed(); !ok || speed != 3 {
+		t.Errorf("expected speed 3 got %d %v", speed, ok)
+	}
+	if months, ok := v.ServiceInterval(); !ok || months != 4 {
+		t.Errorf("expected service interval 4 got %d %v", months, ok)
+	}
+	status, ok := v.Status()
+	if !ok || !status.Power || !status.Filter || status.Fault {
+		t.Errorf("unexpected status %+v %v", status, ok)
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0xff))
+	if _, ok := v.OutdoorTemp(); ok {
+		t.Errorf("faulty outdoor temp sensor reported ok")
+	}
+	if len(v.Snapshot()) != 4 {
+		t.Errorf("expected 4 cached registers got %d", len(v.Snapshot()))
+	}
+}
+
+func TestPostHeatingAccessors(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	if _, ok := v.PostHeatingSetpoint(); ok {
+		t.Errorf("post-heating setpoint known before any events")
+	}
+
+	target, _ := tempToValue(17)
+	setpoint, _ := tempToValue(20)
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterPostHeatingTarget, target))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterPostHeatingSetpoint, setpoint))
+
+	if temp, ok := v.PostHeatingTarget(); !ok || temp != 17 {
+		t.Errorf("expected post-heating target 17 got %d %v", temp, ok)
+	}
+	if temp, ok := v.PostHeatingSetpoint(); !ok || temp != 20 {
+		t.Errorf("expected post-heating setpoint 20 got %d %v", temp, ok)
+	}
+	if e, _ := v.Get(RegisterPostHeatingSetpoint); e.Value != (Temperature{Celsius: 20}) {
+		t.Errorf("unexpected post-heating setpoint event value %v", e.Value)
+	}
+}
+
+func TestCurrentCO2(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentCO2, 0x02))
+	if _, ok := v.CurrentCO2(); ok {
+		t.Errorf("co2 known with only high byte")
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterMaximumCO2, 0x58))
+	if co2, ok := v.CurrentCO2(); !ok || co2 != 600 {
+		t.Errorf("expected 600 ppm got %d %v", co2, ok)
+	}
+
+	if co2 := decodeCO2(0x03, 0xe8); co2 != 1000 {
+		t.Errorf("expected 1000 ppm got %d", co2)
+	}
+	if co2 := decodeCO2(0x01, 0x90); co2 != 400 {
+		t.Errorf("expected 400 ppm got %d", co2)
+	}
+
+	v, _ = newVallox(nil, Config{})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterMaximumCO2, 0x58))
+	if _, ok := v.CurrentCO2(); ok {
+		t.Errorf("co2 known with only low byte")
+	}
+}
+
+func TestCurrentCO2Frames(t *testing.T) {
+	// Frames of the two halves as sent on the bus, including the checksum.
+	// These are constructed from the documented byte order, not captured
+	// from a unit with a known reading. Replace or extend them with a
+	// captured pair when one is available.
+	tests := []struct {
+		high, low [6]byte
+		ppm       uint16
+	}{
+		{[6]byte{0x01, 0x11, 0x20, 0x2b, 0x02, 0x5f}, [6]byte{0x01, 0x11, 0x20, 0x2c, 0x58, 0xb6}, 600},
+		{[6]byte{0x01, 0x11, 0x20, 0x2b, 0x03, 0x60}, [6]byte{0x01, 0x11, 0x20, 0x2c, 0xe8, 0x46}, 1000},
+	}
+	for _, test := range tests {
+		v, _ := newVallox(nil, Config{})
+		feedBuffer(v, test.high[:])
+		feedBuffer(v, test.low[:])
+		if co2, ok := v.CurrentCO2(); !ok || co2 != test.ppm {
+			t.Errorf("expected %d ppm from %x %x got %d %v", test.ppm, test.high, test.low, co2, ok)
+		}
+	}
+}
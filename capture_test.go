@@ -0,0 +1,83 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestRawCapture(t *testing.T) {
+	captured := make(chanWriter, 1)
+	v, _ := newVallox(nil, Config{RawCapture: captured})
+	go handleCapture(v)
+	defer close(v.done)
+
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80)
+	before := time.Now()
+	feedBuffer(v, append([]byte{0xff}, frame...))
+
+	var record []byte
+	select {
+	case record = <-captured:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for capture")
+	}
+	if len(record) != captureRecordSize {
+		t.Fatalf("expected one record got %d bytes", len(record))
+	}
+	timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(record[:8])))
+	if timestamp.Before(before) || timestamp.After(time.Now()) {
+		t.Errorf("unexpected timestamp %v", timestamp)
+	}
+	if !bytes.Equal(record[8:], frame) {
+		t.Errorf("expected frame %x got %x", frame, record[8:])
+	}
+}
+
+func TestRawCaptureClock(t *testing.T) {
+	v, _ := newVallox(nil, Config{RawCapture: new(bytes.Buffer)})
+	clock := newFakeClock(v)
+	captureFrame(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80))
+	record := <-v.capture
+	if timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(record[:8]))); !timestamp.Equal(clock.Now()) {
+		t.Errorf("expected timestamp %v got %v", clock.Now(), timestamp)
+	}
+}
+
+// chanWriter sends a copy of each write to the channel
+type chanWriter chan []byte
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func TestReplay(t *testing.T) {
+	var capture bytes.Buffer
+	start := time.Now()
+	for i, temp := range []byte{0x80, 0x81, 0x82} {
+		var record captureRecord
+		binary.BigEndian.PutUint64(record[:8], uint64(start.Add(time.Duration(i)*10*time.Millisecond).UnixNano()))
+		copy(record[8:], testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, temp))
+		capture.Write(record[:])
+	}
+
+	v, err := Replay(&capture, Config{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw []byte
+	for e := range v.Events() {
+		raw = append(raw, e.RawValue)
+	}
+	if !bytes.Equal(raw, []byte{0x80, 0x81, 0x82}) {
+		t.Errorf("unexpected replayed values %x", raw)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("recorded timing not honored, replay took %v", elapsed)
+	}
+	if v.Running() {
+		t.Errorf("still running after replay")
+	}
+}
@@ -0,0 +1,65 @@
+package valloxrs485
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoFreeClientId is returned by Open when Config.AutoClientId is set and
+// all the panel ids 0x21-0x2f are in use
+var ErrNoFreeClientId = errors.New("no free client id")
+
+// detectClientId observes the bus for Config.AutoClientId and changes the
+// client id to a free one
+func detectClientId(vallox *Vallox) error {
+	timer := time.NewTimer(vallox.autoClientId)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-vallox.done:
+		return ErrClosed
+	}
+
+	seen := atomic.LoadUint32(&vallox.seenPanels)
+	id, ok := freeClientId(seen, vallox.RemoteClientId())
+	if !ok {
+		return ErrNoFreeClientId
+	}
+	vallox.logDebug.Debugf("panels seen %016b, using client id %x", seen, id)
+	return vallox.SetRemoteClientId(id)
+}
+
+// freeClientId returns preferred if it is a valid client id not in seen, or
+// the highest free panel id 0x21-0x2f
+func freeClientId(seen uint32, preferred byte) (byte, bool) {
+	if validClientId(preferred) && seen&(1<<(preferred-MsgPanels)) == 0 {
+		return preferred, true
+	}
+	for id := byte(0x2f); validClientId(id); id-- {
+		if seen&(1<<(id-MsgPanels)) == 0 {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// validClientId returns true if id is a panel id 0x21-0x2f. 0x20 is the
+// broadcast address of the panels.
+func validClientId(id byte) bool {
+	return id > MsgPanels && id <= 0x2f
+}
+
+// recordPanel marks source as a seen panel
+func recordPanel(vallox *Vallox, source byte) {
+	if !validClientId(source) {
+		return
+	}
+	bit := uint32(1) << (source - MsgPanels)
+	for {
+		seen := atomic.LoadUint32(&vallox.seenPanels)
+		if seen&bit != 0 || atomic.CompareAndSwapUint32(&vallox.seenPanels, seen, seen|bit) {
+			return
+		}
+	}
+}
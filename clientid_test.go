@@ -0,0 +1,40 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreeClientId(t *testing.T) {
+	if id, ok := freeClientId(0, 0x27); !ok || id != 0x27 {
+		t.Errorf("expected preferred id 27 got %x %v", id, ok)
+	}
+	if id, ok := freeClientId(1<<7|1<<0xf, 0x27); !ok || id != 0x2e {
+		t.Errorf("expected id 2e got %x %v", id, ok)
+	}
+	if _, ok := freeClientId(0xfffe, 0x27); ok {
+		t.Errorf("expected no free id")
+	}
+	// the panel broadcast address is never picked
+	if id, ok := freeClientId(0, MsgPanels); !ok || id != 0x2f {
+		t.Errorf("expected id 2f instead of broadcast got %x %v", id, ok)
+	}
+	if _, ok := freeClientId(0xfffe, MsgPanels); ok {
+		t.Errorf("expected no free id")
+	}
+}
+
+func TestAutoClientId(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{AutoClientId: 20 * time.Millisecond})
+	defer v.Close()
+	port.feed(append(testFrame(MsgDomain, 0x27, MsgMainboard1, 0, RegisterOutdoorTemp),
+		testFrame(MsgDomain, 0x2f, MsgMainboard1, 0, RegisterOutdoorTemp)...))
+
+	if err := v.start(); err != nil {
+		t.Fatal(err)
+	}
+	if id := v.RemoteClientId(); id != 0x2e {
+		t.Errorf("expected client id 2e got %x", id)
+	}
+}
@@ -0,0 +1,39 @@
+package valloxrs485
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// coalesceKey identifies writes replacing each other
+type coalesceKey struct {
+	destination byte
+	register    byte
+}
+
+// coalesceWrite holds pkg for Config.CoalesceWindow before queueing it. A
+// write to the same destination and register within the window replaces the
+// value of the held one, writes to other registers are held separately.
+func coalesceWrite(vallox *Vallox, pkg *valloxPackage) {
+	key := coalesceKey{pkg.Destination, pkg.Register}
+
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	if held, ok := vallox.coalesced[key]; ok {
+		vallox.logDebug.Debugf("coalesced write %x %x = %x into %x", pkg.Destination, pkg.Register, held.Value, pkg.Value)
+		vallox.coalesced[key] = *pkg
+		return
+	}
+	vallox.coalesced[key] = *pkg
+	// count the held write as pending for Flush
+	atomic.AddInt32(&vallox.pending, 1)
+	time.AfterFunc(vallox.coalesceWindow, func() {
+		vallox.mu.Lock()
+		latest := vallox.coalesced[key]
+		delete(vallox.coalesced, key)
+		vallox.mu.Unlock()
+
+		vallox.enqueue(&latest)
+		atomic.AddInt32(&vallox.pending, -1)
+	})
+}
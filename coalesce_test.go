@@ -0,0 +1,66 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoalesceWrites(t *testing.T) {
+	v, _ := newVallox(nil, Config{
+		EnableWrite:       true,
+		WritableRegisters: []byte{RegisterCurrentFanSpeed, RegisterServiceInterval},
+		CoalesceWindow:    20 * time.Millisecond,
+	})
+	defer close(v.done)
+
+	for speed := FanSpeed(1); speed <= 5; speed++ {
+		if err := v.SetSpeed(speed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.SetServiceInterval(6); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.out) != 0 {
+		t.Fatalf("writes queued before the window ended")
+	}
+
+	expected := map[coalesceKey]byte{
+		{MsgMainboard1, RegisterCurrentFanSpeed}: FanSpeed5,
+		{MsgPanels, RegisterCurrentFanSpeed}:     FanSpeed5,
+		{MsgMainboard1, RegisterServiceInterval}: 6,
+		{MsgPanels, RegisterServiceInterval}:     6,
+	}
+	for n := len(expected); n > 0; n-- {
+		select {
+		case pkg := <-v.out:
+			key := coalesceKey{pkg.Destination, pkg.Register}
+			if value, ok := expected[key]; !ok || value != pkg.Value {
+				t.Errorf("unexpected write %x %x = %x", pkg.Destination, pkg.Register, pkg.Value)
+			}
+			delete(expected, key)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for writes %v", expected)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(v.out) != 0 {
+		t.Errorf("expected the burst coalesced, %d more writes queued", len(v.out))
+	}
+}
+
+func TestCoalesceFlush(t *testing.T) {
+	v, _ := newVallox(newFakePort(), Config{EnableWrite: true, CoalesceWindow: 10 * time.Millisecond})
+	v.startBus()
+	defer v.Close()
+
+	if err := v.SetSpeed(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if sent := v.Metrics().FramesSent; sent != 2 {
+		t.Errorf("expected the held writes sent before flush returned, sent %d", sent)
+	}
+}
@@ -0,0 +1,68 @@
+package valloxrs485
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// discoveryDevice groups the discovered entities under one device in Home Assistant
+var discoveryDevice = map[string]interface{}{
+	"identifiers":  []string{"vallox"},
+	"name":         "Vallox",
+	"manufacturer": "Vallox",
+}
+
+// discoveryDeviceClasses are the Home Assistant device classes of register kinds
+var discoveryDeviceClasses = map[RegisterKind]string{
+	KindTemperature: "temperature",
+	KindHumidity:    "humidity",
+}
+
+// publishDiscovery publishes Home Assistant MQTT discovery configs of the known
+// registers to <discovery prefix>/<component>/vallox_<register_name>/config
+func publishDiscovery(client MQTTClient, opts MQTTOptions) error {
+	for register := 1; register <= 0xff; register++ {
+		info, ok := LookupRegister(byte(register))
+		if !ok || info.Kind == KindFlags {
+			continue
+		}
+		component, config := discoveryConfig(byte(register), info, opts)
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		topic := opts.DiscoveryPrefix + "/" + component + "/vallox_" + info.Name + "/config"
+		if err := client.Publish(topic, true, payload); err != nil {
+			return fmt.Errorf("publishing %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// discoveryConfig returns the entity component and config of register
+func discoveryConfig(register byte, info RegisterInfo, opts MQTTOptions) (string, map[string]interface{}) {
+	topic := opts.TopicPrefix + "/" + info.Name
+	config := map[string]interface{}{
+		"name":           "Vallox " + info.Name,
+		"unique_id":      "vallox_" + info.Name,
+		"state_topic":    topic,
+		"value_template": "{{ value_json.value }}",
+		"device":         discoveryDevice,
+	}
+	if info.Unit != "" {
+		config["unit_of_measurement"] = info.Unit
+	}
+	if class, ok := discoveryDeviceClasses[info.Kind]; ok {
+		config["device_class"] = class
+	}
+
+	if _, ok := mqttSetters[register]; ok && opts.EnableSet {
+		config["command_topic"] = topic + "/set"
+		if info.Kind == KindFanSpeed {
+			config["min"] = 1
+			config["max"] = 8
+		}
+		return "number", config
+	}
+	return "sensor", config
+}
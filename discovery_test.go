@@ -0,0 +1,46 @@
+package valloxrs485
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPublishDiscovery(t *testing.T) {
+	client := newFakeMQTTClient()
+	v, _ := newVallox(nil, Config{})
+	if err := PublishMQTT(v, client, MQTTOptions{EnableSet: true, EnableDiscovery: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	configs := make(map[string]map[string]interface{})
+	for len(client.published) > 0 {
+		msg := <-client.published
+		if !msg.retained {
+			t.Errorf("discovery config %s not retained", msg.topic)
+		}
+		var config map[string]interface{}
+		if err := json.Unmarshal(msg.payload, &config); err != nil {
+			t.Fatal(err)
+		}
+		configs[msg.topic] = config
+	}
+
+	temp, ok := configs["homeassistant/sensor/vallox_outdoor_temp/config"]
+	if !ok {
+		t.Fatalf("outdoor temp config missing from %d configs", len(configs))
+	}
+	if temp["device_class"] != "temperature" || temp["unit_of_measurement"] != UnitCelsius || temp["state_topic"] != "vallox/outdoor_temp" {
+		t.Errorf("unexpected config %v", temp)
+	}
+
+	speed, ok := configs["homeassistant/number/vallox_current_fan_speed/config"]
+	if !ok {
+		t.Fatal("fan speed number config missing")
+	}
+	if speed["command_topic"] != "vallox/current_fan_speed/set" || speed["max"] != 8.0 {
+		t.Errorf("unexpected config %v", speed)
+	}
+	if _, ok := configs["homeassistant/sensor/vallox_flags06/config"]; ok {
+		t.Errorf("flags published as a sensor")
+	}
+}
@@ -0,0 +1,26 @@
+package valloxrs485
+
+// FireplaceSwitchPressed returns channel receiving the RegisterIO08 event
+// each time IO08FlagFireplaceSwitch changes from 0 to 1, i.e. the boost button
+// of the unit is pressed. The flag being already set in the first IO08 value
+// received is not a press. Notifications are dropped if the channel is full.
+func (vallox *Vallox) FireplaceSwitchPressed() <-chan Event {
+	return vallox.fireplaceSwitch
+}
+
+// notifyFireplaceSwitch sends e to the FireplaceSwitchPressed channel if it
+// sets the fireplace switch flag that was clear in the cached IO08 value. It
+// must be called before e is cached.
+func notifyFireplaceSwitch(vallox *Vallox, e *Event) {
+	if e.Register != RegisterIO08 || e.RawValue&IO08FlagFireplaceSwitch == 0 {
+		return
+	}
+	previous, ok := vallox.cachedRaw(RegisterIO08)
+	if !ok || previous&IO08FlagFireplaceSwitch != 0 {
+		return
+	}
+	select {
+	case vallox.fireplaceSwitch <- *e:
+	default:
+	}
+}
@@ -0,0 +1,25 @@
+package valloxrs485
+
+import "testing"
+
+func TestFireplaceSwitchPressed(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+
+	// already pressed when first seen
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO08, IO08FlagFireplaceSwitch))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO08, IO08FlagFireplaceSwitch|IO08FlagMotorIn))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO08, IO08FlagMotorIn))
+	if n := len(v.FireplaceSwitchPressed()); n != 0 {
+		t.Fatalf("expected no press before a rising edge got %d", n)
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO08, IO08FlagFireplaceSwitch|IO08FlagMotorIn))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO08, IO08FlagFireplaceSwitch|IO08FlagMotorIn))
+	if n := len(v.FireplaceSwitchPressed()); n != 1 {
+		t.Fatalf("expected 1 press got %d", n)
+	}
+	e := <-v.FireplaceSwitchPressed()
+	if flags, ok := e.Value.(IO08Flags); !ok || !flags.FireplaceSwitch || !flags.MotorIn {
+		t.Errorf("unexpected press event %+v", e)
+	}
+}
@@ -0,0 +1,200 @@
+package valloxrs485
+
+// StatusFlags are the decoded flags of RegisterStatus
+type StatusFlags struct {
+	Power       bool `json:"power"`
+	CO2         bool `json:"co2"`
+	RH          bool `json:"rh"`
+	HeatingMode bool `json:"heating_mode"`
+	Filter      bool `json:"filter"`
+	Heating     bool `json:"heating"`
+	Fault       bool `json:"fault"`
+	Service     bool `json:"service"`
+}
+
+// IO08Flags are the decoded flags of RegisterIO08
+type IO08Flags struct {
+	SummerMode      bool `json:"summer_mode"`
+	ErrorRelay      bool `json:"error_relay"`
+	MotorIn         bool `json:"motor_in"`
+	Preheating      bool `json:"preheating"`
+	MotorOut        bool `json:"motor_out"`
+	FireplaceSwitch bool `json:"fireplace_switch"`
+}
+
+// IO07Flags are the decoded flags of RegisterIO07
+type IO07Flags struct {
+	Reheating bool `json:"reheating"`
+}
+
+// Flags02 are the decoded flags of RegisterFlags02
+type Flags02 struct {
+	CO2HigherSpeedReq   bool `json:"co2_higher_speed_req"`
+	CO2LowerSpeedReq    bool `json:"co2_lower_speed_req"`
+	RHLowerSpeedReq     bool `json:"rh_lower_speed_req"`
+	SwitchLowerSpeedReq bool `json:"switch_lower_speed_req"`
+	CO2Alarm            bool `json:"co2_alarm"`
+	CellFreezeAlarm     bool `json:"cell_freeze_alarm"`
+}
+
+// ProgramFlags are the decoded flags of RegisterProgram
+type ProgramFlags struct {
+	AutomaticHumidity bool `json:"automatic_humidity"`
+	BoostSwitch       bool `json:"boost_switch"`
+	Water             bool `json:"water"`
+	CascadeControl    bool `json:"cascade_control"`
+}
+
+// Byte encodes the flags to the bits of RegisterProgram, the other bits of the
+// register are zero
+func (flags ProgramFlags) Byte() byte {
+	var value byte
+	if flags.AutomaticHumidity {
+		value |= ProgramFlagAutomaticHumidity
+	}
+	if flags.BoostSwitch {
+		value |= ProgramFlagBoostSwitch
+	}
+	if flags.Water {
+		value |= ProgramFlagWater
+	}
+	if flags.CascadeControl {
+		value |= ProgramFlagCascadeControl
+	}
+	return value
+}
+
+// Program2Flags are the decoded flags of RegisterProgram2
+type Program2Flags struct {
+	MaximumSpeedLimit bool `json:"maximum_speed_limit"`
+}
+
+// CO2Status are the decoded installed sensor flags of RegisterCO2Status
+type CO2Status struct {
+	Sensor1 bool `json:"sensor1"`
+	Sensor2 bool `json:"sensor2"`
+	Sensor3 bool `json:"sensor3"`
+	Sensor4 bool `json:"sensor4"`
+	Sensor5 bool `json:"sensor5"`
+}
+
+// Sensors returns the numbers 1-5 of the installed CO2 sensors
+func (status CO2Status) Sensors() []int {
+	var sensors []int
+	for i, present := range []bool{status.Sensor1, status.Sensor2, status.Sensor3, status.Sensor4, status.Sensor5} {
+		if present {
+			sensors = append(sensors, i+1)
+		}
+	}
+	return sensors
+}
+
+// Flags04 are the decoded flags of RegisterFlags04
+type Flags04 struct {
+	// Master is the id 0-7 of the master board, the bits 5-7 of Flags4Master.
+	// The lowest bit of the nibble is Flags4WaterCoilFreezing and not part of
+	// the id.
+	Master            byte `json:"master"`
+	WaterCoilFreezing bool `json:"water_coil_freezing"`
+}
+
+// Flags05 are the decoded flags of RegisterFlags05
+type Flags05 struct {
+	// PreheatingStatus is the high nibble Flags5PreheatingStatus shifted to
+	// 0-15. The meaning of the values is not documented, 0 when preheating
+	// is not active.
+	PreheatingStatus byte `json:"preheating_status"`
+}
+
+// Flags06 are the decoded flags of RegisterFlags06
+type Flags06 struct {
+	RemoteControl           bool `json:"remote_control"`
+	ActivateFireplaceSwitch bool `json:"activate_fireplace_switch"`
+	FireplaceFunction       bool `json:"fireplace_function"`
+}
+
+func decodeStatus(value byte) StatusFlags {
+	return StatusFlags{
+		Power:       value&StatusFlagPower != 0,
+		CO2:         value&StatusFlagCO2 != 0,
+		RH:          value&StatusFlagRH != 0,
+		HeatingMode: value&StatusFlagHeatingMode != 0,
+		Filter:      value&StatusFlagFilter != 0,
+		Heating:     value&StatusFlagHeating != 0,
+		Fault:       value&StatusFlagFault != 0,
+		Service:     value&StatusFlagService != 0,
+	}
+}
+
+func decodeIO08(value byte) IO08Flags {
+	return IO08Flags{
+		SummerMode:      value&IO08FlagSummerMode != 0,
+		ErrorRelay:      value&IO08FlagErrorRelay != 0,
+		MotorIn:         value&IO08FlagMotorIn != 0,
+		Preheating:      value&IO08FlagPreheating != 0,
+		MotorOut:        value&IO08FlagMotorOut != 0,
+		FireplaceSwitch: value&IO08FlagFireplaceSwitch != 0,
+	}
+}
+
+func decodeIO07(value byte) IO07Flags {
+	return IO07Flags{
+		Reheating: value&IO07FlagReheating != 0,
+	}
+}
+
+func decodeFlags02(value byte) Flags02 {
+	return Flags02{
+		CO2HigherSpeedReq:   value&Flags2CO2HigherSpeedReq != 0,
+		CO2LowerSpeedReq:    value&Flags2CO2LowerSpeedReq != 0,
+		RHLowerSpeedReq:     value&Flags2RHLowerSpeedReq != 0,
+		SwitchLowerSpeedReq: value&Flags2SwitchLowerSpeedReq != 0,
+		CO2Alarm:            value&Flags2CO2Alarm != 0,
+		CellFreezeAlarm:     value&Flags2CellFreezeAlarm != 0,
+	}
+}
+
+func decodeProgram(value byte) ProgramFlags {
+	return ProgramFlags{
+		AutomaticHumidity: value&ProgramFlagAutomaticHumidity != 0,
+		BoostSwitch:       value&ProgramFlagBoostSwitch != 0,
+		Water:             value&ProgramFlagWater != 0,
+		CascadeControl:    value&ProgramFlagCascadeControl != 0,
+	}
+}
+
+func decodeProgram2(value byte) Program2Flags {
+	return Program2Flags{
+		MaximumSpeedLimit: value&Program2FlagMaximumSpeedLimit != 0,
+	}
+}
+
+func decodeCO2Status(value byte) CO2Status {
+	return CO2Status{
+		Sensor1: value&CO2Sensor1 != 0,
+		Sensor2: value&CO2Sensor2 != 0,
+		Sensor3: value&CO2Sensor3 != 0,
+		Sensor4: value&CO2Sensor4 != 0,
+		Sensor5: value&CO2Sensor5 != 0,
+	}
+}
+
+func decodeFlags04(value byte) Flags04 {
+	const masterId = Flags4Master &^ Flags4WaterCoilFreezing
+	return Flags04{
+		Master:            (value & masterId) >> 5,
+		WaterCoilFreezing: value&Flags4WaterCoilFreezing != 0,
+	}
+}
+
+func decodeFlags05(value byte) Flags05 {
+	return Flags05{PreheatingStatus: (value & Flags5PreheatingStatus) >> 4}
+}
+
+func decodeFlags06(value byte) Flags06 {
+	return Flags06{
+		RemoteControl:           value&Flags6RemoteControl != 0,
+		ActivateFireplaceSwitch: value&Flags6ActivateFireplaceSwitch != 0,
+		FireplaceFunction:       value&Flags6FireplaceFunction != 0,
+	}
+}
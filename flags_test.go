@@ -0,0 +1,110 @@
+package valloxrs485
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeIO08(t *testing.T) {
+	flags := decodeIO08(IO08FlagSummerMode | IO08FlagFireplaceSwitch)
+	expected := IO08Flags{SummerMode: true, FireplaceSwitch: true}
+	if flags != expected {
+		t.Errorf("expected %+v got %+v", expected, flags)
+	}
+
+	v, _ := newVallox(nil, Config{})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO08, IO08FlagMotorIn))
+	e := <-v.in
+	if e.Value != (IO08Flags{MotorIn: true}) || e.RawValue != IO08FlagMotorIn {
+		t.Errorf("unexpected event value %+v raw %x", e.Value, e.RawValue)
+	}
+}
+
+func TestDecodeIO07(t *testing.T) {
+	if flags := decodeIO07(IO07FlagReheating | 0x01); !flags.Reheating {
+		t.Errorf("reheating flag not decoded")
+	}
+	if flags := decodeIO07(^IO07FlagReheating); flags.Reheating {
+		t.Errorf("reheating decoded from other bits")
+	}
+}
+
+func TestDecodeFlags02(t *testing.T) {
+	flags := decodeFlags02(Flags2CO2Alarm | Flags2CellFreezeAlarm)
+	expected := Flags02{CO2Alarm: true, CellFreezeAlarm: true}
+	if flags != expected {
+		t.Errorf("expected %+v got %+v", expected, flags)
+	}
+	if flags := decodeFlags02(Flags2RHLowerSpeedReq); flags != (Flags02{RHLowerSpeedReq: true}) {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+}
+
+func TestDecodeProgram(t *testing.T) {
+	flags := decodeProgram(ProgramFlagAutomaticHumidity | ProgramFlagCascadeControl | 0x0f)
+	expected := ProgramFlags{AutomaticHumidity: true, CascadeControl: true}
+	if flags != expected {
+		t.Errorf("expected %+v got %+v", expected, flags)
+	}
+	if flags := decodeProgram2(Program2FlagMaximumSpeedLimit); !flags.MaximumSpeedLimit {
+		t.Errorf("maximum speed limit not decoded")
+	}
+}
+
+func TestProgramFlagsByte(t *testing.T) {
+	for value := 0; value <= 0xff; value++ {
+		if b := decodeProgram(byte(value)).Byte(); b != byte(value)&programFlagMask {
+			t.Errorf("program %x decoded and encoded to %x", value, b)
+		}
+	}
+}
+
+func TestDecodeCO2Status(t *testing.T) {
+	status := decodeCO2Status(CO2Sensor1 | CO2Sensor3 | CO2Sensor5)
+	if !reflect.DeepEqual(status.Sensors(), []int{1, 3, 5}) {
+		t.Errorf("expected sensors 1, 3, 5 got %v", status.Sensors())
+	}
+	status = decodeCO2Status(CO2Sensor2 | 0x01)
+	if status != (CO2Status{Sensor2: true}) {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if sensors := decodeCO2Status(0).Sensors(); len(sensors) != 0 {
+		t.Errorf("expected no sensors got %v", sensors)
+	}
+}
+
+func TestDecodeFlags04(t *testing.T) {
+	if flags := decodeFlags04(0x40); flags != (Flags04{Master: 2}) {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+	if flags := decodeFlags04(Flags4WaterCoilFreezing); flags != (Flags04{WaterCoilFreezing: true}) {
+		t.Errorf("expected only water coil freezing got %+v", flags)
+	}
+	// the freezing bit is not part of the master id
+	if flags := decodeFlags04(0x80 | Flags4WaterCoilFreezing); flags != (Flags04{Master: 4, WaterCoilFreezing: true}) {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+	if flags := decodeFlags04(Flags4Master); flags != (Flags04{Master: 7, WaterCoilFreezing: true}) {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+}
+
+func TestDecodeFlags05(t *testing.T) {
+	if flags := decodeFlags05(0xa3); flags.PreheatingStatus != 0x0a {
+		t.Errorf("expected preheating status 10 got %+v", flags)
+	}
+	if flags := decodeFlags05(0x0f); flags.PreheatingStatus != 0 {
+		t.Errorf("expected preheating status 0 got %+v", flags)
+	}
+}
+
+func TestDecodeFlags06(t *testing.T) {
+	flags := decodeFlags06(Flags6FireplaceFunction | Flags6RemoteControl)
+	expected := Flags06{RemoteControl: true, FireplaceFunction: true}
+	if flags != expected {
+		t.Errorf("expected %+v got %+v", expected, flags)
+	}
+	if flags := decodeFlags06(Flags6ActivateFireplaceSwitch); flags != (Flags06{ActivateFireplaceSwitch: true}) {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+}
@@ -0,0 +1,36 @@
+package valloxrs485
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// flushPollInterval is how often Flush checks for pending frames
+const flushPollInterval = 5 * time.Millisecond
+
+// Flush waits until no frames are pending, i.e. all the queued frames have
+// been transmitted, dropped or cancelled, e.g. to make sure a final SetSpeed
+// reaches the bus before Close. This includes frames queued by other
+// goroutines after the call, so on a busy bus Flush may time out even though
+// the frames of the caller have been sent. Returns an error if frames are
+// still pending after timeout, or ErrClosed if the bus is stopped first.
+func (vallox *Vallox) Flush(timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+	for {
+		pending := atomic.LoadInt32(&vallox.pending)
+		if pending <= 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return fmt.Errorf("flush timed out with %d frames pending", pending)
+		case <-vallox.done:
+			return ErrClosed
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{EnableWrite: true})
+	atomic.StoreInt32(&v.running, 1)
+	go handleOutgoing(v)
+	defer v.Close()
+
+	if err := v.SetSpeed(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	write := createWrite(v, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed3)
+	panels := createWrite(v, MsgPanels, RegisterCurrentFanSpeed, FanSpeed3)
+	expected := []byte{
+		write.System, write.Source, write.Destination, write.Register, write.Value, write.Checksum,
+		panels.System, panels.Source, panels.Destination, panels.Register, panels.Value, panels.Checksum,
+	}
+	port.mu.Lock()
+	written := append([]byte(nil), port.written.Bytes()...)
+	port.mu.Unlock()
+	if !bytes.Equal(written, expected) {
+		t.Errorf("expected %x written before flush returned got %x", expected, written)
+	}
+
+	if err := v.Flush(0); err != nil {
+		t.Errorf("flush with nothing pending failed: %v", err)
+	}
+}
+
+func TestFlushTimeout(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	defer close(v.done)
+
+	// nothing drains the queue
+	v.Query(RegisterSupplyTemp)
+	if err := v.Flush(10 * time.Millisecond); err == nil {
+		t.Errorf("flush succeeded with a frame pending")
+	}
+}
@@ -0,0 +1,39 @@
+package valloxrs485
+
+import "testing"
+
+func FuzzHandleBuffer(f *testing.F) {
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64)
+	f.Add(frame, byte(6))
+	f.Add(append([]byte{0x01, 0x01}, frame...), byte(1))
+	f.Add(append(frame[:4:4], frame...), byte(3))
+
+	f.Fuzz(func(t *testing.T, data []byte, chunk byte) {
+		v, _ := newVallox(nil, Config{IncludeRawFrame: true})
+		total := len(data)
+		size := int(chunk%8) + 1
+		for len(data) > 0 {
+			n := size
+			if n > len(data) {
+				n = len(data)
+			}
+			feedBuffer(v, data[:n])
+			data = data[n:]
+			for len(v.in) > 0 {
+				e := <-v.in
+				raw := e.RawFrame
+				if raw[0] != MsgDomain || raw[5] != Checksum(raw[0], raw[1], raw[2], raw[3], raw[4]) {
+					t.Fatalf("event from invalid frame %x", raw)
+				}
+			}
+		}
+		remaining := bufferedBytes(v)
+		if remaining >= 6 {
+			t.Errorf("%d bytes left unhandled", remaining)
+		}
+		stats := v.Metrics()
+		if handled := int(stats.FramesRead)*6 + int(stats.BytesDiscarded) + remaining; handled != total {
+			t.Errorf("%d bytes accounted for out of %d", handled, total)
+		}
+	})
+}
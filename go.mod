@@ -1,6 +1,6 @@
 module github.com/jokujossai/vallox-rs485
 
-go 1.17
+go 1.18
 
 require github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
 
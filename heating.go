@@ -0,0 +1,94 @@
+package valloxrs485
+
+// HeatingMode tells which of the heaters are on
+type HeatingMode int
+
+const (
+	// HeatingOff is when neither preheating nor post-heating is on
+	HeatingOff HeatingMode = iota
+	// HeatingPreheating is when only preheating of outdoor air is on
+	HeatingPreheating
+	// HeatingPostHeating is when only post-heating of supply air is on
+	HeatingPostHeating
+	// HeatingBoth is when both preheating and post-heating are on
+	HeatingBoth
+)
+
+// String returns off, preheating, post-heating or both
+func (mode HeatingMode) String() string {
+	switch mode {
+	case HeatingOff:
+		return "off"
+	case HeatingPreheating:
+		return "preheating"
+	case HeatingPostHeating:
+		return "post-heating"
+	case HeatingBoth:
+		return "both"
+	}
+	return "unknown"
+}
+
+// HeatingState is a view of the preheating and post-heating registers. Values
+// of registers not yet received from the bus are zero.
+type HeatingState struct {
+	// Active is true when any heater is on
+	Active bool        `json:"active"`
+	Mode   HeatingMode `json:"mode"`
+	// PreheatingStatus is Flags05.PreheatingStatus
+	PreheatingStatus byte `json:"preheating_status"`
+	// PreheatingTemp is the outdoor temperature below which preheating is used
+	PreheatingTemp int8 `json:"preheating_temp"`
+	// PostHeatingTarget is the supply air temperature post-heating is
+	// currently heating to
+	PostHeatingTarget int8 `json:"post_heating_target"`
+	// PostHeatingSetpoint is the configured post-heating setpoint
+	PostHeatingSetpoint int8 `json:"post_heating_setpoint"`
+	// PostHeatingOnTime and PostHeatingOffTime are the post-heating on and
+	// off times in percent
+	PostHeatingOnTime  float64 `json:"post_heating_on_time"`
+	PostHeatingOffTime float64 `json:"post_heating_off_time"`
+	// PostHeatingDuty is the on time in percent of the on and off times
+	PostHeatingDuty float64 `json:"post_heating_duty"`
+}
+
+// HeatingState returns the latest state of the heating from the cached
+// values of the related registers. Not ok until RegisterIO07 or RegisterIO08,
+// telling whether the heaters are on, has been received.
+func (vallox *Vallox) HeatingState() (HeatingState, bool) {
+	io07, io07ok := vallox.cachedValue(RegisterIO07)
+	io08, io08ok := vallox.cachedValue(RegisterIO08)
+	if !io07ok && !io08ok {
+		return HeatingState{}, false
+	}
+
+	var state HeatingState
+	if raw, ok := vallox.cachedValue(RegisterFlags05); ok {
+		state.PreheatingStatus = decodeFlags05(raw).PreheatingStatus
+	}
+	state.PreheatingTemp, _ = vallox.cachedSetting(RegisterPreheatingTemp)
+	state.PostHeatingTarget, _ = vallox.cachedSetting(RegisterPostHeatingTarget)
+	state.PostHeatingSetpoint, _ = vallox.cachedSetting(RegisterPostHeatingSetpoint)
+	if raw, ok := vallox.cachedValue(RegisterPostHeatingOnTime); ok {
+		state.PostHeatingOnTime = decodePostHeatingTime(raw)
+	}
+	if raw, ok := vallox.cachedValue(RegisterPostHeatingOffTime); ok {
+		state.PostHeatingOffTime = decodePostHeatingTime(raw)
+	}
+	if total := state.PostHeatingOnTime + state.PostHeatingOffTime; total > 0 {
+		state.PostHeatingDuty = state.PostHeatingOnTime / total * 100
+	}
+
+	preheating := decodeIO08(io08).Preheating || state.PreheatingStatus != 0
+	postHeating := decodeIO07(io07).Reheating
+	switch {
+	case preheating && postHeating:
+		state.Mode = HeatingBoth
+	case preheating:
+		state.Mode = HeatingPreheating
+	case postHeating:
+		state.Mode = HeatingPostHeating
+	}
+	state.Active = state.Mode != HeatingOff
+	return state, true
+}
@@ -0,0 +1,37 @@
+package valloxrs485
+
+import "testing"
+
+func TestHeatingState(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	if _, ok := v.HeatingState(); ok {
+		t.Errorf("heating state known before any events")
+	}
+
+	target, _ := tempToValue(18)
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO07, 0))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO08, IO08FlagMotorIn))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterPostHeatingTarget, target))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterPostHeatingOnTime, 50))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterPostHeatingOffTime, 150))
+	state, ok := v.HeatingState()
+	if !ok || state.Active || state.Mode != HeatingOff {
+		t.Errorf("expected heating off got %+v %v", state, ok)
+	}
+	if state.PostHeatingTarget != 18 || state.PostHeatingOnTime != 20 || state.PostHeatingOffTime != 60 || state.PostHeatingDuty != 25 {
+		t.Errorf("unexpected post-heating values %+v", state)
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO07, IO07FlagReheating))
+	if state, _ := v.HeatingState(); !state.Active || state.Mode != HeatingPostHeating {
+		t.Errorf("expected post-heating got %+v", state)
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterFlags05, 0x30))
+	if state, _ := v.HeatingState(); state.Mode != HeatingBoth || state.PreheatingStatus != 3 {
+		t.Errorf("expected both heaters got %+v", state)
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterIO07, 0))
+	if state, _ := v.HeatingState(); state.Mode != HeatingPreheating || state.Mode.String() != "preheating" {
+		t.Errorf("expected preheating got %+v", state)
+	}
+}
@@ -0,0 +1,99 @@
+package valloxrs485
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FormatInfluxLine formats e as an InfluxDB line protocol record of
+// measurement vallox with tags register_name and source, and timestamp of
+// Event.Time. Numeric values are written to float field value and flags to
+// boolean fields named as in JSON. Returns false for events without a value,
+// like queries and faulty sensors.
+func FormatInfluxLine(e Event) (string, bool) {
+	if e.Register == 0 {
+		return "", false
+	}
+	fields := influxFields(e.Value)
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("vallox,register_name=%s,source=%d %s %d\n",
+		RegisterName(e.Register), e.Source, strings.Join(fields, ","), e.Time.UnixNano()), true
+}
+
+// WriteInflux writes every event from the Events channel to w in InfluxDB
+// line protocol, see FormatInfluxLine, until the Events channel is closed.
+// Writers with a Flush method are flushed after each line. Returns the first
+// write error, or nil when the instance is closed.
+func (vallox *Vallox) WriteInflux(w io.Writer) error {
+	f, _ := w.(flusher)
+	for e := range vallox.Events() {
+		line, ok := FormatInfluxLine(e)
+		if !ok {
+			continue
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+		if f != nil {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// influxFields returns the line protocol fields of a decoded event value
+func influxFields(value interface{}) []string {
+	switch v := value.(type) {
+	case Temperature:
+		if v.Fault {
+			return nil
+		}
+		return []string{influxFloat("value", float64(v.Celsius))}
+	case FanSpeed:
+		if !v.IsValid() {
+			return nil
+		}
+		return []string{influxFloat("value", float64(v))}
+	case float64:
+		return []string{influxFloat("value", v)}
+	case int16:
+		return []string{influxFloat("value", float64(v))}
+	case Message:
+		return []string{influxFloat("value", float64(v))}
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []string
+	for i := 0; i < rv.NumField(); i++ {
+		name := strings.Split(rv.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		field := rv.Field(i)
+		switch field.Kind() {
+		case reflect.Bool:
+			fields = append(fields, name+"="+strconv.FormatBool(field.Bool()))
+		case reflect.Uint8, reflect.Uint16, reflect.Int8, reflect.Int16:
+			if field.CanInt() {
+				fields = append(fields, influxFloat(name, float64(field.Int())))
+			} else {
+				fields = append(fields, influxFloat(name, float64(field.Uint())))
+			}
+		}
+	}
+	return fields
+}
+
+func influxFloat(name string, value float64) string {
+	return name + "=" + strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,48 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFormatInfluxLine(t *testing.T) {
+	at := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		e        Event
+		expected string
+	}{
+		{Event{Time: at, Source: MsgMainboard1, Register: RegisterOutdoorTemp, Value: Temperature{Celsius: -5}},
+			"vallox,register_name=outdoor_temp,source=17 value=-5 1633089600000000000\n"},
+		{Event{Time: at, Source: MsgMainboard1, Register: RegisterRH1, Value: 45.1},
+			"vallox,register_name=rh1,source=17 value=45.1 1633089600000000000\n"},
+		{Event{Time: at, Source: MsgMainboard1, Register: RegisterFlags04, Value: Flags04{Master: 1, WaterCoilFreezing: true}},
+			"vallox,register_name=flags04,source=17 master=1,water_coil_freezing=true 1633089600000000000\n"},
+	}
+	for _, test := range tests {
+		if line, ok := FormatInfluxLine(test.e); !ok || line != test.expected {
+			t.Errorf("expected %q got %q", test.expected, line)
+		}
+	}
+
+	if _, ok := FormatInfluxLine(Event{Register: RegisterSupplyTemp, Value: Temperature{Fault: true}}); ok {
+		t.Errorf("faulty sensor formatted")
+	}
+	if _, ok := FormatInfluxLine(Event{Register: 0, Value: int16(RegisterSupplyTemp)}); ok {
+		t.Errorf("query formatted")
+	}
+}
+
+func TestWriteInflux(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed3))
+	close(v.in)
+
+	var out bytes.Buffer
+	if err := v.WriteInflux(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte("vallox,register_name=current_fan_speed,source=17 value=3 ")) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
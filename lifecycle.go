@@ -0,0 +1,48 @@
+package valloxrs485
+
+import "time"
+
+// ConnectionState is the state of the connection to the bus
+type ConnectionState int
+
+const (
+	// StateConnected is entered when communication starts
+	StateConnected ConnectionState = iota
+	// StateDisconnected is entered on Close or a fatal error
+	StateDisconnected
+)
+
+// String returns connected or disconnected
+func (state ConnectionState) String() string {
+	switch state {
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	}
+	return "unknown"
+}
+
+// LifecycleEvent tells about a change of the connection state
+type LifecycleEvent struct {
+	State ConnectionState
+	Time  time.Time
+	// Err is the fatal error causing a disconnect, nil after Close
+	Err error
+}
+
+// Lifecycle returns channel for connection state changes, e.g. for showing
+// an online indicator. Unlike Errors it only tells about transitions.
+// Notifications are dropped if the channel is full.
+func (vallox *Vallox) Lifecycle() <-chan LifecycleEvent {
+	return vallox.lifecycle
+}
+
+// notifyLifecycle sends a state change to the Lifecycle channel, or drops it
+// if the channel is full
+func notifyLifecycle(vallox *Vallox, state ConnectionState, err error) {
+	select {
+	case vallox.lifecycle <- LifecycleEvent{State: state, Time: vallox.now(), Err: err}:
+	default:
+	}
+}
@@ -0,0 +1,39 @@
+package valloxrs485
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{})
+	v.startBus()
+	assertLifecycle(v, StateConnected, nil, t)
+
+	v.Close()
+	v.Close()
+	assertLifecycle(v, StateDisconnected, nil, t)
+	if len(v.Lifecycle()) != 0 {
+		t.Errorf("disconnect notified twice")
+	}
+
+	v, _ = newVallox(newFakePort(), Config{})
+	v.startBus()
+	assertLifecycle(v, StateConnected, nil, t)
+	failure := errors.New("device removed")
+	fatalError(failure, v)
+	assertLifecycle(v, StateDisconnected, failure, t)
+}
+
+func assertLifecycle(v *Vallox, state ConnectionState, err error, t *testing.T) {
+	t.Helper()
+	select {
+	case e := <-v.Lifecycle():
+		if e.State != state || e.Err != err {
+			t.Errorf("expected %v %v got %v %v", state, err, e.State, e.Err)
+		}
+	default:
+		t.Errorf("expected %v, nothing notified", state)
+	}
+}
@@ -0,0 +1,27 @@
+package valloxrs485
+
+import (
+	"log"
+)
+
+// Logger receives debug output of the package
+type Logger interface {
+	Debugf(format string, args ...interface{})
+}
+
+// StdLogger adapts a standard library logger to Logger
+func StdLogger(logger *log.Logger) Logger {
+	return stdLogger{logger}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+}
+
+func (l stdLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Printf(format, args...)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
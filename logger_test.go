@@ -0,0 +1,17 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var out bytes.Buffer
+	v, _ := newVallox(nil, Config{LogDebug: log.New(&out, "", 0)})
+	v.SetSpeed(9)
+	if !strings.Contains(out.String(), "invalid speed") {
+		t.Errorf("debug output not logged: %q", out.String())
+	}
+}
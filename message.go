@@ -0,0 +1,44 @@
+package valloxrs485
+
+import "fmt"
+
+// Message is the decoded code of RegisterMessage. The message codes are not
+// documented, the known codes assume the same values as the Fault* codes of
+// RegisterFaultCode. The code is encoded to JSON as a number, String
+// describes it.
+type Message byte
+
+// Known message codes
+const (
+	MessageNone                  Message = 0x00
+	MessageSupplySensorFault     Message = Message(FaultSupplyAirSensorFault)
+	MessageCO2Alarm              Message = Message(FaultCarbonDioxideAlarm)
+	MessageOutdoorSensorFault    Message = Message(FaultOutdoorSensorFault)
+	MessageExhaustInSensorFault  Message = Message(FaultExhaustAirInSensorFault)
+	MessageWaterCoilFreezing     Message = Message(FaultWaterCoilFreezing)
+	MessageExhaustOutSensorFault Message = Message(FaultExhaustAirOutSensorFault)
+)
+
+var messageText = map[Message]string{
+	MessageNone:                  "no message",
+	MessageSupplySensorFault:     "supply air sensor fault",
+	MessageCO2Alarm:              "carbon dioxide alarm",
+	MessageOutdoorSensorFault:    "outdoor air sensor fault",
+	MessageExhaustInSensorFault:  "exhaust air inside sensor fault",
+	MessageWaterCoilFreezing:     "water coil freezing danger",
+	MessageExhaustOutSensorFault: "exhaust air outside sensor fault",
+}
+
+// Known returns true if the message code is known
+func (message Message) Known() bool {
+	_, ok := messageText[message]
+	return ok
+}
+
+// String describes the message, or returns unknown message xx for unknown codes
+func (message Message) String() string {
+	if text, ok := messageText[message]; ok {
+		return text
+	}
+	return fmt.Sprintf("unknown message %02x", byte(message))
+}
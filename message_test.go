@@ -0,0 +1,23 @@
+package valloxrs485
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	e := decodeEvent(&valloxPackage{Register: RegisterMessage, Value: 0x09}, nil)
+	message, ok := e.Value.(Message)
+	if !ok || message != MessageWaterCoilFreezing || !message.Known() {
+		t.Fatalf("unexpected value %#v", e.Value)
+	}
+	if s := message.String(); s != "water coil freezing danger" {
+		t.Errorf("unexpected text %s", s)
+	}
+	if s := Message(0x42).String(); s != "unknown message 42" {
+		t.Errorf("unexpected text %s", s)
+	}
+	if b, _ := json.Marshal(message); string(b) != "9" {
+		t.Errorf("message encoded as %s", b)
+	}
+}
@@ -0,0 +1,116 @@
+package valloxrs485
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MQTTClient is the part of an MQTT client used by PublishMQTT. It is small
+// enough to be implemented with a few lines on top of any MQTT library, so
+// this package does not depend on one.
+type MQTTClient interface {
+	// Publish publishes payload to topic
+	Publish(topic string, retained bool, payload []byte) error
+	// Subscribe calls handler for each message published to topic
+	Subscribe(topic string, handler func(topic string, payload []byte)) error
+}
+
+// MQTTOptions configures PublishMQTT
+type MQTTOptions struct {
+	// TopicPrefix of the published topics, default "vallox"
+	TopicPrefix string
+	// EnableSet subscribes to <prefix>/<register_name>/set topics of the
+	// registers with a setter and calls the setter with the received value
+	EnableSet bool
+	// EnableDiscovery publishes retained Home Assistant MQTT discovery
+	// configs describing the registers as sensors, and with EnableSet the
+	// registers with a setter as number entities
+	EnableDiscovery bool
+	// DiscoveryPrefix of the discovery topics, default "homeassistant"
+	DiscoveryPrefix string
+}
+
+// mqttSetters are the setters available for <prefix>/<register_name>/set topics
+var mqttSetters = map[byte]func(vallox *Vallox, value int) error{
+	RegisterCurrentFanSpeed: func(vallox *Vallox, value int) error {
+		return vallox.SetSpeed(intToFanSpeed(value))
+	},
+	RegisterDefaultFanSpeed: func(vallox *Vallox, value int) error {
+		return vallox.SetDefaultFanSpeed(intToFanSpeed(value))
+	},
+	RegisterMaxFanSpeed: func(vallox *Vallox, value int) error {
+		return vallox.SetMaxFanSpeed(intToFanSpeed(value))
+	},
+}
+
+// intToFanSpeed converts value to a FanSpeed, out of range values to the
+// invalid speed 0 instead of wrapping around
+func intToFanSpeed(value int) FanSpeed {
+	if value < 1 || value > len(fanSpeedConversion) {
+		return 0
+	}
+	return FanSpeed(value)
+}
+
+// PublishMQTT publishes every event from vallox as JSON to topic
+// <prefix>/<register_name>, see RegisterName
+func PublishMQTT(vallox *Vallox, client MQTTClient, opts MQTTOptions) error {
+	if opts.TopicPrefix == "" {
+		opts.TopicPrefix = "vallox"
+	}
+
+	if opts.DiscoveryPrefix == "" {
+		opts.DiscoveryPrefix = "homeassistant"
+	}
+
+	if opts.EnableDiscovery {
+		if err := publishDiscovery(client, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.EnableSet {
+		for register, setter := range mqttSetters {
+			if err := subscribeMQTTSetter(vallox, client, opts, register, setter); err != nil {
+				return err
+			}
+		}
+	}
+
+	vallox.OnEvent(func(e Event) {
+		if e.Register == 0 {
+			// queries have no value
+			return
+		}
+		payload, err := json.Marshal(e)
+		if err != nil {
+			vallox.logDebug.Debugf("error encoding event %x: %v", e.Register, err)
+			return
+		}
+		topic := opts.TopicPrefix + "/" + RegisterName(e.Register)
+		if err := client.Publish(topic, false, payload); err != nil {
+			vallox.logDebug.Debugf("error publishing %s: %v", topic, err)
+		}
+	})
+	return nil
+}
+
+func subscribeMQTTSetter(vallox *Vallox, client MQTTClient, opts MQTTOptions, register byte, setter func(*Vallox, int) error) error {
+	topic := opts.TopicPrefix + "/" + RegisterName(register) + "/set"
+	err := client.Subscribe(topic, func(topic string, payload []byte) {
+		value, err := strconv.Atoi(strings.TrimSpace(string(payload)))
+		if err != nil {
+			vallox.logDebug.Debugf("invalid value %q received from %s", payload, topic)
+			return
+		}
+		if err := setter(vallox, value); err != nil {
+			vallox.logDebug.Debugf("error setting %s = %d: %v", RegisterName(register), value, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("subscribing %s: %w", topic, err)
+	}
+	return nil
+}
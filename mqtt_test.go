@@ -0,0 +1,73 @@
+package valloxrs485
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublishMQTT(t *testing.T) {
+	client := newFakeMQTTClient()
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	go dispatchEvents(v)
+	defer close(v.done)
+
+	if err := PublishMQTT(v, client, MQTTOptions{EnableSet: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64))
+	select {
+	case msg := <-client.published:
+		if msg.topic != "vallox/outdoor_temp" || !strings.Contains(string(msg.payload), `"value":0`) {
+			t.Errorf("unexpected message %s %s", msg.topic, msg.payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for publish")
+	}
+
+	client.receive("vallox/current_fan_speed/set", []byte("5\n"))
+	assertWrite(v, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed5, t)
+	client.receive("vallox/current_fan_speed/set", []byte("fast"))
+	client.receive("vallox/current_fan_speed/set", []byte("10"))
+	assertWrite(v, MsgPanels, RegisterCurrentFanSpeed, FanSpeed5, t)
+	if len(v.out) != 0 {
+		t.Errorf("invalid values were written")
+	}
+}
+
+type mqttMessage struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+type fakeMQTTClient struct {
+	published chan mqttMessage
+	mu        sync.Mutex
+	handlers  map[string]func(string, []byte)
+}
+
+func newFakeMQTTClient() *fakeMQTTClient {
+	return &fakeMQTTClient{published: make(chan mqttMessage, 100), handlers: make(map[string]func(string, []byte))}
+}
+
+func (client *fakeMQTTClient) Publish(topic string, retained bool, payload []byte) error {
+	client.published <- mqttMessage{topic, retained, payload}
+	return nil
+}
+
+func (client *fakeMQTTClient) Subscribe(topic string, handler func(string, []byte)) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.handlers[topic] = handler
+	return nil
+}
+
+func (client *fakeMQTTClient) receive(topic string, payload []byte) {
+	client.mu.Lock()
+	handler := client.handlers[topic]
+	client.mu.Unlock()
+	handler(topic, payload)
+}
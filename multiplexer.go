@@ -0,0 +1,172 @@
+package valloxrs485
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// BusEvent is an event from one of the buses of a Multiplexer
+type BusEvent struct {
+	// Bus is the id the bus was added with
+	Bus   string `json:"bus"`
+	Event Event  `json:"event"`
+}
+
+// Multiplexer merges events of several Vallox buses, e.g. units on separate
+// rs485 segments, into a single channel and fans out writes to all of them.
+// A bus stopping does not affect the others, a reconnected instance can be
+// added again with the same id. The Multiplexer reads the Events channel of
+// every bus, it must not be read elsewhere. Use OnEvent or Subscribe of a bus
+// for other consumers.
+type Multiplexer struct {
+	mu    sync.Mutex
+	buses map[string]*Vallox
+	// stop ends forwarding the events of a bus when it is replaced
+	stop   map[string]chan struct{}
+	events chan BusEvent
+	done   chan struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewMultiplexer returns a Multiplexer of buses by id
+func NewMultiplexer(buses map[string]*Vallox) *Multiplexer {
+	m := &Multiplexer{
+		buses:  make(map[string]*Vallox),
+		stop:   make(map[string]chan struct{}),
+		events: make(chan BusEvent, 100),
+		done:   make(chan struct{}),
+	}
+	for id, vallox := range buses {
+		m.Add(id, vallox)
+	}
+	return m
+}
+
+// Add adds vallox as bus id, replacing a previous bus with the same id. The
+// replaced bus is not closed, but its events are no longer forwarded.
+func (m *Multiplexer) Add(id string, vallox *Vallox) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if stop, ok := m.stop[id]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	m.buses[id] = vallox
+	m.stop[id] = stop
+	m.wg.Add(1)
+	go m.forward(id, vallox, stop)
+	return nil
+}
+
+// Bus returns the bus added with id
+func (m *Multiplexer) Bus(id string) (*Vallox, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	vallox, ok := m.buses[id]
+	return vallox, ok
+}
+
+// Events returns channel for events from all the buses. The channel is closed
+// when the Multiplexer is closed.
+func (m *Multiplexer) Events() <-chan BusEvent {
+	return m.events
+}
+
+// Each calls fn for every bus in order of id. Every bus is called even if
+// some fail, the returned error tells the failed buses.
+func (m *Multiplexer) Each(fn func(id string, vallox *Vallox) error) error {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.buses))
+	for id := range m.buses {
+		ids = append(ids, id)
+	}
+	buses := make(map[string]*Vallox, len(m.buses))
+	for id, vallox := range m.buses {
+		buses[id] = vallox
+	}
+	m.mu.Unlock()
+	sort.Strings(ids)
+
+	var failed []error
+	for _, id := range ids {
+		if err := fn(id, buses[id]); err != nil {
+			failed = append(failed, fmt.Errorf("bus %s: %w", id, err))
+		}
+	}
+	return joinErrors(failed)
+}
+
+// SetSpeed changes speed of ventilation fan on all the buses
+func (m *Multiplexer) SetSpeed(speed FanSpeed) error {
+	return m.Each(func(id string, vallox *Vallox) error {
+		return vallox.SetSpeed(speed)
+	})
+}
+
+// Close closes all the buses and the Events channel
+func (m *Multiplexer) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.done)
+	m.mu.Unlock()
+
+	err := m.Each(func(id string, vallox *Vallox) error {
+		return vallox.Close()
+	})
+	m.wg.Wait()
+	close(m.events)
+	return err
+}
+
+// forward sends the events of a bus to the merged channel until the bus stops,
+// stop is closed or the Multiplexer is closed
+func (m *Multiplexer) forward(id string, vallox *Vallox, stop <-chan struct{}) {
+	defer m.wg.Done()
+	events := vallox.Events()
+	for {
+		var e Event
+		var ok bool
+		select {
+		case e, ok = <-events:
+			if !ok {
+				return
+			}
+		case <-stop:
+			return
+		case <-m.done:
+			return
+		}
+		select {
+		case m.events <- BusEvent{Bus: id, Event: e}:
+		case <-stop:
+			return
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// joinErrors returns nil, the only error or an error listing all of errs
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	msg := errs[0].Error()
+	for _, err := range errs[1:] {
+		msg += "; " + err.Error()
+	}
+	return errors.New(msg)
+}
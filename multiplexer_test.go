@@ -0,0 +1,83 @@
+package valloxrs485
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultiplexer(t *testing.T) {
+	ports := map[string]*fakePort{"a": newFakePort(), "b": newFakePort()}
+	buses := make(map[string]*Vallox)
+	for id, port := range ports {
+		v, _ := newVallox(port, Config{})
+		v.startBus()
+		buses[id] = v
+	}
+	m := NewMultiplexer(buses)
+
+	ports["a"].feed(testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed2))
+	assertBusEvent(m, "a", RegisterCurrentFanSpeed, t)
+
+	// a failing bus does not affect the others
+	buses["a"].Close()
+	ports["b"].feed(testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64))
+	assertBusEvent(m, "b", RegisterOutdoorTemp, t)
+
+	err := m.SetSpeed(3)
+	if err == nil || !strings.Contains(err.Error(), "bus a") || !strings.Contains(err.Error(), "bus b") {
+		t.Errorf("expected errors of both buses got %v", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("close failed: %v", err)
+	}
+	if _, ok := <-m.Events(); ok {
+		t.Errorf("events channel not closed")
+	}
+	if err := m.Add("c", buses["a"]); err != ErrClosed {
+		t.Errorf("expected ErrClosed got %v", err)
+	}
+}
+
+func TestMultiplexerReplaceBus(t *testing.T) {
+	replaced, _ := newVallox(newFakePort(), Config{})
+	replaced.startBus()
+	defer replaced.Close()
+	m := NewMultiplexer(map[string]*Vallox{"a": replaced})
+
+	port := newFakePort()
+	v, _ := newVallox(port, Config{})
+	v.startBus()
+	if err := m.Add("a", v); err != nil {
+		t.Fatal(err)
+	}
+	port.feed(testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed2))
+	assertBusEvent(m, "a", RegisterCurrentFanSpeed, t)
+
+	closed := make(chan error)
+	go func() {
+		closed <- m.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("close failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close blocked by the replaced bus")
+	}
+	assertBoolean(true, replaced.Running(), t)
+}
+
+func assertBusEvent(m *Multiplexer, bus string, register byte, t *testing.T) {
+	t.Helper()
+	select {
+	case e := <-m.Events():
+		if e.Bus != bus || e.Event.Register != register {
+			t.Errorf("expected register %x from bus %s got %x from %s", register, bus, e.Event.Register, e.Bus)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+}
@@ -0,0 +1,50 @@
+package valloxrs485
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// pollRegisters queries Config.PollRegisters every Config.PollInterval until
+// the instance is closed. A tick is skipped while queries of the previous
+// poll are still waiting to be sent, so that a slow bus does not collect a
+// backlog of polls.
+func pollRegisters(vallox *Vallox) {
+	ticker := time.NewTicker(vallox.pollInterval)
+	defer ticker.Stop()
+	// sent receives the outcome of each poll query sent or dropped
+	sent := make(chan error, len(vallox.pollRegisters))
+	waiting := 0
+	for {
+		select {
+		case <-ticker.C:
+			for ; waiting > 0 && len(sent) > 0; waiting-- {
+				<-sent
+			}
+			if waiting > 0 {
+				vallox.logDebug.Debugf("skipping poll, %d queries of the previous poll pending", waiting)
+				continue
+			}
+			waiting = queuePoll(vallox, sent)
+		case <-vallox.done:
+			return
+		}
+	}
+}
+
+// queuePoll queues a query of each of Config.PollRegisters reporting to sent,
+// and returns the number queued. Queries not fitting in the out queue are
+// left for the next poll.
+func queuePoll(vallox *Vallox, sent chan<- error) int {
+	for i, register := range vallox.pollRegisters {
+		atomic.AddInt32(&vallox.pending, 1)
+		select {
+		case vallox.out <- outgoing{valloxPackage: *createQuery(vallox, register), result: sent}:
+		default:
+			atomic.AddInt32(&vallox.pending, -1)
+			vallox.logDebug.Debugf("out queue full, polled %d of %d registers", i, len(vallox.pollRegisters))
+			return i
+		}
+	}
+	return len(vallox.pollRegisters)
+}
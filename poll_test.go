@@ -0,0 +1,73 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollRegisters(t *testing.T) {
+	v, _ := newVallox(nil, Config{PollInterval: time.Millisecond, PollRegisters: []byte{RegisterServiceCounter}})
+	go pollRegisters(v)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case pkg := <-v.out:
+			if pkg.Register != 0 || pkg.Value != RegisterServiceCounter {
+				t.Errorf("expected query of service counter got %x = %x", pkg.Register, pkg.Value)
+			}
+			pkg.done(nil)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for poll")
+		}
+	}
+
+	close(v.done)
+	time.Sleep(10 * time.Millisecond)
+	for len(v.out) > 0 {
+		<-v.out
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(v.out) != 0 {
+		t.Errorf("polling continued after close")
+	}
+}
+
+func TestPollSkippedWhilePending(t *testing.T) {
+	v, _ := newVallox(nil, Config{PollInterval: time.Millisecond, PollRegisters: []byte{RegisterServiceCounter, RegisterServiceInterval}})
+	go pollRegisters(v)
+	defer close(v.done)
+
+	var polled []outgoing
+	for len(polled) < 2 {
+		select {
+		case pkg := <-v.out:
+			polled = append(polled, pkg)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for poll")
+		}
+	}
+	// the queries have not been sent, no new poll
+	time.Sleep(20 * time.Millisecond)
+	if len(v.out) != 0 {
+		t.Fatalf("polled again while %d queries pending", len(v.out))
+	}
+
+	for _, pkg := range polled {
+		pkg.done(nil)
+	}
+	select {
+	case pkg := <-v.out:
+		if pkg.Register != 0 || pkg.Value != RegisterServiceCounter {
+			t.Errorf("expected query of service counter got %x = %x", pkg.Register, pkg.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the next poll")
+	}
+}
+
+func TestPollDisabledByDefault(t *testing.T) {
+	v, _ := newVallox(nil, Config{PollRegisters: []byte{RegisterServiceCounter}})
+	if v.pollInterval != 0 {
+		t.Errorf("polling enabled without interval")
+	}
+}
@@ -0,0 +1,49 @@
+package valloxrs485
+
+import (
+	"context"
+	"time"
+)
+
+// tokenBucket limits the rate of writes, allowing bursts of up to one second
+// worth of writes
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perSecond int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: float64(perSecond), tokens: float64(perSecond), last: now}
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (bucket *tokenBucket) reserve(now time.Time) time.Duration {
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.rate {
+		bucket.tokens = bucket.rate
+	}
+	bucket.last = now
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// waitWriteLimit waits until a write is allowed by Config.MaxWritesPerSecond.
+// Returns the error of ctx if it is done first, or ErrClosed if the bus is
+// stopped.
+func waitWriteLimit(vallox *Vallox, ctx context.Context, pkg *valloxPackage) error {
+	if vallox.writeLimit == nil || pkg.Register == 0 {
+		// no limit, queries are not limited
+		return nil
+	}
+	wait := vallox.writeLimit.reserve(vallox.now())
+	if wait == 0 {
+		return nil
+	}
+	incrementStat(&vallox.metrics.WriteDelays)
+	vallox.logDebug.Debugf("write rate limit, delay outgoing to %x %x = %x by %v", pkg.Destination, pkg.Register, pkg.Value, wait)
+	return sleepContext(vallox, ctx, wait)
+}
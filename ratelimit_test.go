@@ -0,0 +1,36 @@
+package valloxrs485
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(2, time.Now())
+	now := bucket.last
+	if wait := bucket.reserve(now); wait != 0 {
+		t.Errorf("first write delayed by %v", wait)
+	}
+	if wait := bucket.reserve(now); wait != 0 {
+		t.Errorf("burst write delayed by %v", wait)
+	}
+	if wait := bucket.reserve(now); wait != 500*time.Millisecond {
+		t.Errorf("expected 500ms delay got %v", wait)
+	}
+	if wait := bucket.reserve(now.Add(time.Second)); wait != 0 {
+		t.Errorf("write after refill delayed by %v", wait)
+	}
+}
+
+func TestQueriesNotRateLimited(t *testing.T) {
+	v, _ := newVallox(nil, Config{MaxWritesPerSecond: 1})
+	for i := 0; i < 10; i++ {
+		if waitWriteLimit(v, context.Background(), createQuery(v, RegisterSupplyTemp)) != nil {
+			t.Fatal("query was not allowed")
+		}
+	}
+	if v.writeLimit.tokens != 1 {
+		t.Errorf("queries used write tokens")
+	}
+}
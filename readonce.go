@@ -0,0 +1,27 @@
+package valloxrs485
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReadOnce opens device, queries register, waits up to timeout for a
+// mainboard to answer and closes the device again, e.g. for reading the
+// outdoor temperature from a shell script. Unlike Open it does not query all
+// the known registers.
+func ReadOnce(device string, register byte, timeout time.Duration) (Event, error) {
+	vallox, err := open(Config{Device: device}, false)
+	if err != nil {
+		return Event{}, err
+	}
+	defer vallox.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	e, err := vallox.QuerySync(ctx, register)
+	if err != nil {
+		return Event{}, fmt.Errorf("reading %s: %w", RegisterName(register), err)
+	}
+	return e, nil
+}
@@ -0,0 +1,25 @@
+package valloxrs485
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadOnceOpenError(t *testing.T) {
+	if _, err := ReadOnce("/nonexistent/vallox", RegisterOutdoorTemp, time.Millisecond); err == nil {
+		t.Errorf("reading a missing device succeeded")
+	}
+}
+
+func TestStartSkipInit(t *testing.T) {
+	v, _ := newVallox(newFakePort(), Config{})
+	v.skipInit = true
+	if err := v.start(); err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if n := atomic.LoadInt32(&v.pending); n != 0 {
+		t.Errorf("expected no init queries got %d", n)
+	}
+}
@@ -0,0 +1,106 @@
+package valloxrs485
+
+import (
+	"fmt"
+)
+
+// RegisterKind tells how the value of a register is decoded
+type RegisterKind int
+
+const (
+	// KindRaw is a plain number
+	KindRaw RegisterKind = iota
+	// KindTemperature is a Temperature in degrees Celsius
+	KindTemperature
+	// KindHumidity is relative humidity in percent
+	KindHumidity
+	// KindFanSpeed is a FanSpeed step 1-8
+	KindFanSpeed
+	// KindPercent is a percentage
+	KindPercent
+	// KindFlags is a struct of named booleans
+	KindFlags
+	// KindMessage is a Message code
+	KindMessage
+)
+
+// Units of register values
+const (
+	UnitCelsius = "°C"
+	UnitPercent = "%"
+	UnitMinutes = "min"
+	UnitMonths  = "months"
+)
+
+// RegisterInfo describes a register
+type RegisterInfo struct {
+	// Name is a snake case identifier of the register
+	Name string
+	// Unit of the decoded value, empty if the value has no unit
+	Unit string
+	// Kind tells how the value is decoded
+	Kind RegisterKind
+}
+
+var registerInfo = map[byte]RegisterInfo{
+	RegisterIO07:                 {"io07", "", KindFlags},
+	RegisterIO08:                 {"io08", "", KindFlags},
+	RegisterCurrentFanSpeed:      {"current_fan_speed", "", KindFanSpeed},
+	RegisterMaxRH:                {"max_rh", UnitPercent, KindHumidity},
+	RegisterCurrentCO2:           {"co2_high", "", KindRaw},
+	RegisterMaximumCO2:           {"co2_low", "", KindRaw},
+	RegisterCO2Status:            {"co2_status", "", KindFlags},
+	RegisterMessage:              {"message", "", KindMessage},
+	RegisterRH1:                  {"rh1", UnitPercent, KindHumidity},
+	RegisterRH2:                  {"rh2", UnitPercent, KindHumidity},
+	RegisterOutdoorTemp:          {"outdoor_temp", UnitCelsius, KindTemperature},
+	RegisterExhaustOutTemp:       {"exhaust_out_temp", UnitCelsius, KindTemperature},
+	RegisterExhaustInTemp:        {"exhaust_in_temp", UnitCelsius, KindTemperature},
+	RegisterSupplyTemp:           {"supply_temp", UnitCelsius, KindTemperature},
+	RegisterFaultCode:            {"fault_code", "", KindRaw},
+	RegisterPostHeatingOnTime:    {"post_heating_on_time", UnitPercent, KindPercent},
+	RegisterPostHeatingOffTime:   {"post_heating_off_time", UnitPercent, KindPercent},
+	RegisterPostHeatingTarget:    {"post_heating_target", UnitCelsius, KindTemperature},
+	RegisterFlags02:              {"flags02", "", KindFlags},
+	RegisterFlags04:              {"flags04", "", KindFlags},
+	RegisterFlags05:              {"flags05", "", KindFlags},
+	RegisterFlags06:              {"flags06", "", KindFlags},
+	RegisterFireplaceCounter:     {"fireplace_counter", UnitMinutes, KindRaw},
+	RegisterStatus:               {"status", "", KindRaw},
+	RegisterPostHeatingSetpoint:  {"post_heating_setpoint", UnitCelsius, KindTemperature},
+	RegisterMaxFanSpeed:          {"max_fan_speed", "", KindFanSpeed},
+	RegisterServiceInterval:      {"service_interval", UnitMonths, KindRaw},
+	RegisterPreheatingTemp:       {"preheating_temp", UnitCelsius, KindTemperature},
+	RegisterSupplyFanStopTemp:    {"supply_fan_stop_temp", UnitCelsius, KindTemperature},
+	RegisterDefaultFanSpeed:      {"default_fan_speed", "", KindFanSpeed},
+	RegisterProgram:              {"program", "", KindFlags},
+	RegisterServiceCounter:       {"service_counter", UnitMonths, KindRaw},
+	RegisterBasicHumidity:        {"basic_humidity", UnitPercent, KindHumidity},
+	RegisterBypassTemp:           {"bypass_temp", UnitCelsius, KindTemperature},
+	RegisterSupplyFanSetpoint:    {"supply_fan_setpoint", UnitPercent, KindPercent},
+	RegisterExhaustFanSetpoint:   {"exhaust_fan_setpoint", UnitPercent, KindPercent},
+	RegisterAntiFreezeHysteresis: {"anti_freeze_hysteresis", UnitCelsius, KindRaw},
+	RegisterCO2SetpointUpper:     {"co2_setpoint_upper", "", KindRaw},
+	RegisterCO2SetpointLower:     {"co2_setpoint_lower", "", KindRaw},
+	RegisterProgram2:             {"program2", "", KindFlags},
+}
+
+// LookupRegister returns information of a known register
+func LookupRegister(register byte) (RegisterInfo, bool) {
+	info, ok := registerInfo[register]
+	return info, ok
+}
+
+// RegisterName returns the name of register, or register_xx for unknown registers
+func RegisterName(register byte) string {
+	if info, ok := registerInfo[register]; ok {
+		return info.Name
+	}
+	return fmt.Sprintf("register_%02x", register)
+}
+
+// RegisterUnit returns the unit of the decoded value of register, empty if
+// the value has no unit or the register is unknown
+func RegisterUnit(register byte) string {
+	return registerInfo[register].Unit
+}
@@ -0,0 +1,41 @@
+package valloxrs485
+
+import (
+	"testing"
+)
+
+func TestRegisterInfo(t *testing.T) {
+	if name := RegisterName(RegisterOutdoorTemp); name != "outdoor_temp" {
+		t.Errorf("unexpected name %s", name)
+	}
+	if unit := RegisterUnit(RegisterRH1); unit != UnitPercent {
+		t.Errorf("unexpected unit %s", unit)
+	}
+	if name := RegisterName(Register8f); name != "register_8f" {
+		t.Errorf("unexpected name %s for unknown register", name)
+	}
+	if _, ok := LookupRegister(Register8f); ok {
+		t.Errorf("unknown register found")
+	}
+
+	// every decoded register kind must match the decoded value
+	for register, info := range registerInfo {
+		e := decodeEvent(&valloxPackage{Register: register, Value: 0x80}, nil)
+		var ok bool
+		switch info.Kind {
+		case KindTemperature:
+			_, ok = e.Value.(Temperature)
+		case KindFanSpeed:
+			_, ok = e.Value.(FanSpeed)
+		case KindHumidity, KindPercent:
+			_, ok = e.Value.(float64)
+		case KindMessage:
+			_, ok = e.Value.(Message)
+		default:
+			ok = true
+		}
+		if !ok {
+			t.Errorf("register %s decoded to %T", info.Name, e.Value)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package valloxrs485
+
+// sensorFaultCodes are the RegisterFaultCode values reporting a fault of the
+// temperature sensor registers
+var sensorFaultCodes = map[byte]byte{
+	RegisterOutdoorTemp:    FaultOutdoorSensorFault,
+	RegisterExhaustOutTemp: FaultExhaustAirOutSensorFault,
+	RegisterExhaustInTemp:  FaultExhaustAirInSensorFault,
+	RegisterSupplyTemp:     FaultSupplyAirSensorFault,
+}
+
+// IsSensorFault returns true if the temperature sensor of register, one of
+// RegisterOutdoorTemp, RegisterExhaustOutTemp, RegisterExhaustInTemp or
+// RegisterSupplyTemp, is faulty. A sensor is faulty when its latest raw value
+// is TempSensorFault or above, or when the latest RegisterFaultCode reports a
+// fault of the sensor.
+func (vallox *Vallox) IsSensorFault(register byte) bool {
+	if raw, ok := vallox.cachedRaw(register); ok && raw >= TempSensorFault {
+		return true
+	}
+	return faultCodeReported(vallox, register)
+}
+
+// faultCodeReported returns true if the latest RegisterFaultCode reports a
+// fault of the temperature sensor of register
+func faultCodeReported(vallox *Vallox, register byte) bool {
+	code, ok := sensorFaultCodes[register]
+	if !ok {
+		return false
+	}
+	raw, ok := vallox.cachedRaw(RegisterFaultCode)
+	return ok && raw == code
+}
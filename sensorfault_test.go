@@ -0,0 +1,31 @@
+package valloxrs485
+
+import "testing"
+
+func TestSensorFault(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, TempSensorFault))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterExhaustInTemp, 0x80))
+	assertBoolean(true, v.IsSensorFault(RegisterSupplyTemp), t)
+	assertBoolean(false, v.IsSensorFault(RegisterExhaustInTemp), t)
+	assertBoolean(false, v.IsSensorFault(RegisterOutdoorTemp), t)
+
+	// a plausible reading of a sensor reported faulty by the fault code
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterFaultCode, FaultOutdoorSensorFault))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80))
+	assertBoolean(true, v.IsSensorFault(RegisterOutdoorTemp), t)
+	assertBoolean(false, v.IsSensorFault(RegisterExhaustInTemp), t)
+	if e, _ := v.Get(RegisterOutdoorTemp); e.Value != (Temperature{Celsius: valueToTemp(0x80), Fault: true}) {
+		t.Errorf("outdoor temp not decoded as fault %+v", e.Value)
+	}
+	if _, ok := v.OutdoorTemp(); ok {
+		t.Errorf("faulty outdoor temp reported ok")
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterFaultCode, 0))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80))
+	assertBoolean(false, v.IsSensorFault(RegisterOutdoorTemp), t)
+	if e, _ := v.Get(RegisterOutdoorTemp); e.Value != (Temperature{Celsius: valueToTemp(0x80)}) {
+		t.Errorf("outdoor temp still decoded as fault %+v", e.Value)
+	}
+}
@@ -0,0 +1,64 @@
+package valloxrs485
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrBusSilent is reported to Errors when nothing has been read from the bus
+// for Config.SilenceTimeout. It is reported again only after traffic resumes
+// and stops again.
+var ErrBusSilent = errors.New("bus silent")
+
+// LastActivity returns when data was last read from the bus, zero if nothing
+// has been read yet. Frames sent by this client do not count.
+func (vallox *Vallox) LastActivity() time.Time {
+	return getLastRead(vallox)
+}
+
+// Healthy returns true if communication is running and data has been read
+// from the bus within maxIdle, e.g. for a liveness probe
+func (vallox *Vallox) Healthy(maxIdle time.Duration) bool {
+	lastRead := getLastRead(vallox)
+	return vallox.Running() && !lastRead.IsZero() && vallox.now().Sub(lastRead) <= maxIdle
+}
+
+// watchSilence reports ErrBusSilent when the bus has been silent for
+// Config.SilenceTimeout until the instance is closed
+func watchSilence(vallox *Vallox) {
+	interval := vallox.silenceTimeout / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	started := vallox.now()
+	silent := false
+	for {
+		select {
+		case <-ticker.C:
+			lastRead := getLastRead(vallox)
+			if lastRead.IsZero() {
+				lastRead = started
+			}
+			quiet := vallox.now().Sub(lastRead) >= vallox.silenceTimeout
+			if quiet && !silent {
+				vallox.logDebug.Debugf("bus silent since %v", lastRead)
+				reportError(vallox, ErrBusSilent)
+			} else if !quiet && silent {
+				vallox.logDebug.Debugf("bus traffic resumed")
+			}
+			silent = quiet
+		case <-vallox.done:
+			return
+		}
+	}
+}
+
+// reportError sends err to the Errors channel, or drops it if the channel is full
+func reportError(vallox *Vallox, err error) {
+	select {
+	case vallox.errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,110 @@
+package valloxrs485
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchSilence(t *testing.T) {
+	v, _ := newVallox(nil, Config{SilenceTimeout: 20 * time.Millisecond})
+	go watchSilence(v)
+	defer close(v.done)
+
+	select {
+	case err := <-v.Errors():
+		if err != ErrBusSilent {
+			t.Errorf("expected ErrBusSilent got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for silence")
+	}
+
+	// reported once per silence
+	time.Sleep(50 * time.Millisecond)
+	if len(v.Errors()) != 0 {
+		t.Errorf("silence reported again")
+	}
+
+	// traffic resets the detector
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		updateLastRead(v)
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-v.Errors():
+		if err != ErrBusSilent {
+			t.Errorf("expected ErrBusSilent got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for silence after traffic")
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{})
+	if v.Healthy(time.Hour) || !v.LastActivity().IsZero() {
+		t.Errorf("healthy before anything was read")
+	}
+	v.startBus()
+	defer v.Close()
+
+	updateLastActivity(v)
+	if v.Healthy(time.Hour) {
+		t.Errorf("healthy after only writing")
+	}
+
+	before := time.Now()
+	port.feed(testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80))
+	select {
+	case <-v.Events():
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	if v.LastActivity().Before(before) {
+		t.Errorf("last activity %v not updated by read", v.LastActivity())
+	}
+	if !v.Healthy(time.Hour) {
+		t.Errorf("not healthy after read")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if v.Healthy(time.Millisecond) {
+		t.Errorf("healthy after idle")
+	}
+}
+
+func TestHealthyClock(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	clock := newFakeClock(v)
+	atomic.StoreInt32(&v.running, 1)
+
+	updateLastRead(v)
+	if !v.LastActivity().Equal(clock.Now()) {
+		t.Errorf("expected last activity %v got %v", clock.Now(), v.LastActivity())
+	}
+	clock.Advance(time.Second)
+	if !v.Healthy(time.Second) {
+		t.Errorf("not healthy at max idle")
+	}
+	clock.Advance(time.Nanosecond)
+	if v.Healthy(time.Second) {
+		t.Errorf("healthy after max idle")
+	}
+}
+
+func TestWatchSilenceTinyTimeout(t *testing.T) {
+	v, _ := newVallox(nil, Config{SilenceTimeout: time.Nanosecond})
+	go watchSilence(v)
+	defer close(v.done)
+
+	select {
+	case err := <-v.Errors():
+		if err != ErrBusSilent {
+			t.Errorf("expected ErrBusSilent got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for silence")
+	}
+}
@@ -0,0 +1,37 @@
+package valloxrs485
+
+import "math"
+
+// smoothTemp replaces the value of a temperature sensor event with the
+// moving average of the last Config.TempSmoothingWindow readings
+func smoothTemp(vallox *Vallox, e *Event) {
+	if vallox.tempWindow <= 1 {
+		return
+	}
+	temp, ok := e.Value.(Temperature)
+	if !ok || temp.Fault || !isSensorTemp(e.Register) {
+		return
+	}
+
+	readings := append(vallox.tempReadings[e.Register], temp.Celsius)
+	if len(readings) > vallox.tempWindow {
+		readings = readings[len(readings)-vallox.tempWindow:]
+	}
+	vallox.tempReadings[e.Register] = readings
+
+	sum := 0
+	for _, reading := range readings {
+		sum += int(reading)
+	}
+	temp.Celsius = int8(math.Round(float64(sum) / float64(len(readings))))
+	e.Value = temp
+}
+
+// isSensorTemp returns true for the registers of the temperature sensors
+func isSensorTemp(register byte) bool {
+	switch register {
+	case RegisterOutdoorTemp, RegisterSupplyTemp, RegisterExhaustInTemp, RegisterExhaustOutTemp:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package valloxrs485
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTempSmoothing(t *testing.T) {
+	v, _ := newVallox(nil, Config{TempSmoothingWindow: 3})
+
+	raw := []byte{0x80, 0x84, 0x88, 0x8c}
+	var expected []int8
+	for i := range raw {
+		start := i - 2
+		if start < 0 {
+			start = 0
+		}
+		sum := 0
+		for _, r := range raw[start : i+1] {
+			sum += int(ValueToTemp(r))
+		}
+		expected = append(expected, int8(math.Round(float64(sum)/float64(i+1-start))))
+	}
+
+	for i, value := range raw {
+		handlePackage(&valloxPackage{MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, value, 0}, v)
+		e := <-v.in
+		if e.RawValue != value {
+			t.Errorf("expected raw value %x got %x", value, e.RawValue)
+		}
+		assertCelsius(e, expected[i], t)
+	}
+
+	// other registers are averaged separately
+	handlePackage(&valloxPackage{MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80, 0}, v)
+	assertCelsius(<-v.in, ValueToTemp(0x80), t)
+
+	// faults are not smoothed
+	handlePackage(&valloxPackage{MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, TempSensorFault, 0}, v)
+	if temp := (<-v.in).Value.(Temperature); !temp.Fault {
+		t.Errorf("expected fault got %v", temp)
+	}
+}
+
+func TestTempSmoothingDisabled(t *testing.T) {
+	v, _ := newVallox(nil, Config{TempSmoothingWindow: 1})
+	for _, value := range []byte{0x80, 0x8c} {
+		handlePackage(&valloxPackage{MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, value, 0}, v)
+		assertCelsius(<-v.in, ValueToTemp(value), t)
+	}
+}
+
+func assertCelsius(e Event, celsius int8, t *testing.T) {
+	if temp, ok := e.Value.(Temperature); !ok || temp.Celsius != celsius {
+		t.Errorf("expected %d got %v for register %x", celsius, e.Value, e.Register)
+	}
+}
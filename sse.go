@@ -0,0 +1,102 @@
+package valloxrs485
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// sseClientBuffer is the number of events buffered for a client of
+// EventStreamHandler before the client is disconnected
+const sseClientBuffer = 32
+
+// EventStreamHandler returns an HTTP handler streaming events to each client
+// as server-sent events, one JSON encoded event per message, e.g. for a
+// browser dashboard using EventSource. Events are received with OnEvent and
+// fanned out to all the connected clients. A client not keeping up is
+// disconnected instead of delaying the other clients or the bus. Queries are
+// not streamed.
+func EventStreamHandler(vallox *Vallox) http.Handler {
+	stream := &eventStream{vallox: vallox, clients: make(map[chan Event]struct{})}
+	vallox.OnEvent(stream.broadcast)
+	return stream
+}
+
+type eventStream struct {
+	vallox  *Vallox
+	mu      sync.Mutex
+	clients map[chan Event]struct{}
+}
+
+// broadcast sends e to every client, disconnecting clients with a full buffer
+func (stream *eventStream) broadcast(e Event) {
+	if e.Register == 0 {
+		// queries have no value
+		return
+	}
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	for ch := range stream.clients {
+		select {
+		case ch <- e:
+		default:
+			stream.vallox.logDebug.Debugf("event stream client too slow, disconnecting")
+			delete(stream.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+func (stream *eventStream) add(ch chan Event) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.clients[ch] = struct{}{}
+}
+
+func (stream *eventStream) remove(ch chan Event) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if _, ok := stream.clients[ch]; ok {
+		delete(stream.clients, ch)
+		close(ch)
+	}
+}
+
+func (stream *eventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan Event, sseClientBuffer)
+	stream.add(ch)
+	defer stream.remove(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				// disconnected for being too slow
+				return
+			}
+			payload, err := json.Marshal(e)
+			if err != nil {
+				stream.vallox.logDebug.Debugf("error encoding event %x: %v", e.Register, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", payload); err != nil {
+				return
+			}
+			f.Flush()
+		case <-r.Context().Done():
+			return
+		case <-stream.vallox.done:
+			return
+		}
+	}
+}
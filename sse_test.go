@@ -0,0 +1,90 @@
+package valloxrs485
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStreamHandler(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	go dispatchEvents(v)
+	defer close(v.done)
+
+	handler := EventStreamHandler(v)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected content type %s", ct)
+	}
+	waitClients(handler.(*eventStream), 1, t)
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64))
+	lines := make(chan string)
+	go func() {
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+	select {
+	case line := <-lines:
+		if !strings.HasPrefix(line, "data: {") || !strings.Contains(line, `"register_name":"outdoor_temp"`) {
+			t.Errorf("unexpected event line %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+}
+
+func TestEventStreamDropsSlowClient(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	stream := EventStreamHandler(v).(*eventStream)
+	slow := make(chan Event, 1)
+	fast := make(chan Event, 10)
+	stream.add(slow)
+	stream.add(fast)
+
+	stream.broadcast(Event{Register: RegisterOutdoorTemp})
+	stream.broadcast(Event{Register: RegisterSupplyTemp})
+	waitClients(stream, 1, t)
+	if len(fast) != 2 {
+		t.Errorf("expected 2 events for the fast client got %d", len(fast))
+	}
+	<-slow
+	if _, ok := <-slow; ok {
+		t.Errorf("slow client not disconnected")
+	}
+	stream.remove(slow)
+}
+
+func waitClients(stream *eventStream, n int, t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		stream.mu.Lock()
+		clients := len(stream.clients)
+		stream.mu.Unlock()
+		if clients == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d clients got %d", n, clients)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,43 @@
+package valloxrs485
+
+import "time"
+
+// watchStale queries the cached registers not updated for Config.StaleAfter
+// every StaleAfter until the instance is closed
+func watchStale(vallox *Vallox) {
+	ticker := time.NewTicker(vallox.staleAfter)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			queryStale(vallox)
+		case <-vallox.done:
+			return
+		}
+	}
+}
+
+// queryStale marks the cached events older than Config.StaleAfter as stale and
+// queries their registers. Registers still stale are queried again each time,
+// in case the previous query or reply was lost.
+func queryStale(vallox *Vallox) {
+	now := vallox.now()
+	var stale []byte
+	vallox.mu.Lock()
+	for register, e := range vallox.cache {
+		if now.Sub(e.Time) < vallox.staleAfter {
+			continue
+		}
+		if !e.Stale {
+			e.Stale = true
+			vallox.cache[register] = e
+		}
+		stale = append(stale, register)
+	}
+	vallox.mu.Unlock()
+
+	if len(stale) > 0 {
+		vallox.logDebug.Debugf("querying stale registers %x", stale)
+		vallox.QueryAll(stale...)
+	}
+}
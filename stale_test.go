@@ -0,0 +1,47 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryStale(t *testing.T) {
+	v, _ := newVallox(nil, Config{StaleAfter: time.Hour})
+	clock := newFakeClock(v)
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterServiceCounter, 3))
+	clock.Advance(30 * time.Minute)
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80))
+
+	clock.Advance(30 * time.Minute)
+	queryStale(v)
+	assertWrite(v, MsgMainboard1, 0, RegisterServiceCounter, t)
+	if len(v.out) != 0 {
+		t.Errorf("fresh register queried")
+	}
+	if e, _ := v.Get(RegisterServiceCounter); !e.Stale {
+		t.Errorf("old event not marked stale")
+	}
+	if e, _ := v.Get(RegisterOutdoorTemp); e.Stale {
+		t.Errorf("fresh event marked stale")
+	}
+
+	// no reply, queried again
+	queryStale(v)
+	assertWrite(v, MsgMainboard1, 0, RegisterServiceCounter, t)
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterServiceCounter, 3))
+	if e, _ := v.Get(RegisterServiceCounter); e.Stale {
+		t.Errorf("refreshed event still stale")
+	}
+	queryStale(v)
+	if len(v.out) != 0 {
+		t.Errorf("refreshed register queried")
+	}
+}
+
+func TestStaleDisabledByDefault(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	if v.staleAfter != 0 {
+		t.Errorf("stale check enabled by default")
+	}
+}
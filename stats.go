@@ -0,0 +1,64 @@
+package valloxrs485
+
+import (
+	"sync/atomic"
+)
+
+// Metrics are counters of the Vallox bus. The counters are updated atomically
+// by the bus goroutines, Metrics returns a snapshot.
+type Metrics struct {
+	// FramesRead is count of valid frames read from the bus
+	FramesRead uint64
+	// ChecksumErrors is count of invalid frames, consecutive invalid bytes
+	// discarded while resynchronizing are counted as one invalid frame
+	ChecksumErrors uint64
+	// BytesDiscarded is count of bytes discarded while resynchronizing
+	BytesDiscarded uint64
+	// EventsDelivered is count of events delivered to the Events channel
+	EventsDelivered uint64
+	// EventsDropped is count of events dropped because the Events channel
+	// was full
+	EventsDropped uint64
+	// HandlerEventsDropped is count of events not passed to OnEvent handlers
+	// because the handlers did not keep up
+	HandlerEventsDropped uint64
+	// SubscriberEventsDropped is count of events dropped because a Subscribe
+	// channel was full, counted once for each subscriber
+	SubscriberEventsDropped uint64
+	// FramesSent is count of frames written to the bus
+	FramesSent uint64
+	// WriteDelays is count of writes delayed by Config.MaxWritesPerSecond
+	WriteDelays uint64
+}
+
+// Stats is the former name of Metrics.
+//
+// Deprecated: use Metrics.
+type Stats = Metrics
+
+// Metrics returns a snapshot of the bus counters
+func (vallox *Vallox) Metrics() Metrics {
+	return Metrics{
+		FramesRead:      atomic.LoadUint64(&vallox.metrics.FramesRead),
+		ChecksumErrors:  atomic.LoadUint64(&vallox.metrics.ChecksumErrors),
+		BytesDiscarded:  atomic.LoadUint64(&vallox.metrics.BytesDiscarded),
+		EventsDelivered: atomic.LoadUint64(&vallox.metrics.EventsDelivered),
+		EventsDropped:   atomic.LoadUint64(&vallox.metrics.EventsDropped),
+		FramesSent:      atomic.LoadUint64(&vallox.metrics.FramesSent),
+		WriteDelays:     atomic.LoadUint64(&vallox.metrics.WriteDelays),
+
+		HandlerEventsDropped:    atomic.LoadUint64(&vallox.metrics.HandlerEventsDropped),
+		SubscriberEventsDropped: atomic.LoadUint64(&vallox.metrics.SubscriberEventsDropped),
+	}
+}
+
+// Stats returns a snapshot of the bus counters.
+//
+// Deprecated: use Metrics.
+func (vallox *Vallox) Stats() Stats {
+	return vallox.Metrics()
+}
+
+func incrementStat(counter *uint64) {
+	atomic.AddUint64(counter, 1)
+}
@@ -0,0 +1,87 @@
+package valloxrs485
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80)
+	feedBuffer(v, frame)
+	feedBuffer(v, []byte{0x00, 0x01, 0x02})
+	feedBuffer(v, frame)
+	feedBuffer(v, []byte{0x03})
+	feedBuffer(v, frame)
+
+	metrics := v.Metrics()
+	expected := Metrics{FramesRead: 3, ChecksumErrors: 2, BytesDiscarded: 4, EventsDelivered: 3}
+	if metrics != expected {
+		t.Errorf("expected %+v got %+v", expected, metrics)
+	}
+	if stats := v.Stats(); stats != metrics {
+		t.Errorf("expected stats %+v got %+v", metrics, stats)
+	}
+}
+
+func TestWriteDelaysMetric(t *testing.T) {
+	v, _ := newVallox(nil, Config{MaxWritesPerSecond: 1000})
+	defer close(v.done)
+	pkg := createWrite(v, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed2)
+	waitWriteLimit(v, context.Background(), pkg)
+	if delays := v.Metrics().WriteDelays; delays != 0 {
+		t.Errorf("expected no delays got %d", delays)
+	}
+	v.writeLimit.tokens = 0
+	waitWriteLimit(v, context.Background(), pkg)
+	if delays := v.Metrics().WriteDelays; delays != 1 {
+		t.Errorf("expected 1 delay got %d", delays)
+	}
+}
+
+func TestDroppedEventsCountedSeparately(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	v.OnEvent(func(Event) {})
+	_, unsubscribe := v.Subscribe(RegisterSupplyTemp)
+	defer unsubscribe()
+
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80)
+	// the subscriber holds 10 events, the Events and handler queues 100
+	for i := 0; i < 12; i++ {
+		feedBuffer(v, frame)
+	}
+	metrics := v.Metrics()
+	if metrics.SubscriberEventsDropped != 2 {
+		t.Errorf("expected 2 subscriber drops got %d", metrics.SubscriberEventsDropped)
+	}
+	if metrics.EventsDropped != 0 || metrics.HandlerEventsDropped != 0 || v.DroppedEvents() != 0 {
+		t.Errorf("subscriber drops counted as events channel drops %+v", metrics)
+	}
+
+	for i := 0; i < cap(v.in); i++ {
+		feedBuffer(v, frame)
+	}
+	metrics = v.Metrics()
+	if metrics.EventsDropped != 12 || metrics.HandlerEventsDropped != 12 || v.DroppedEvents() != 12 {
+		t.Errorf("expected 12 drops of events and handlers got %+v", metrics)
+	}
+}
+
+func TestBlockedDeliveryEndsOnClose(t *testing.T) {
+	v, _ := newVallox(nil, Config{BlockOnFullQueue: true})
+	ch := make(chan Event)
+	delivered := make(chan bool)
+	go func() {
+		delivered <- deliver(v, ch, &Event{Register: RegisterSupplyTemp}, &v.metrics.EventsDropped)
+	}()
+	close(v.done)
+	select {
+	case ok := <-delivered:
+		if ok {
+			t.Errorf("event delivered without a reader")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delivery still blocked after close")
+	}
+}
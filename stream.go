@@ -0,0 +1,31 @@
+package valloxrs485
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// flusher is implemented by buffered writers such as bufio.Writer
+type flusher interface {
+	Flush() error
+}
+
+// WriteJSONStream writes every event from the Events channel to w as one
+// JSON object per line until the Events channel is closed. Writers with a
+// Flush method are flushed after each line. Returns the first write error, or
+// nil when the instance is closed.
+func (vallox *Vallox) WriteJSONStream(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	f, _ := w.(flusher)
+	for e := range vallox.Events() {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+		if f != nil {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package valloxrs485
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteJSONStream(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed3))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64))
+	close(v.in)
+
+	if err := v.WriteJSONStream(w); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines got %q", out.String())
+	}
+	var e struct {
+		RegisterName string `json:"register_name"`
+		Value        int    `json:"value"`
+	}
+	if err := json.Unmarshal(lines[0], &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.RegisterName != "current_fan_speed" || e.Value != 3 {
+		t.Errorf("unexpected event %s", lines[0])
+	}
+}
@@ -0,0 +1,143 @@
+package valloxrs485
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrClosed is returned when communication has stopped
+var ErrClosed = errors.New("vallox bus closed")
+
+// Subscribe returns a channel receiving events of register and a function to
+// unsubscribe. Events are never waited for, they are dropped if the channel
+// is full. The channel is closed on unsubscribe or when communication stops.
+func (vallox *Vallox) Subscribe(register byte) (<-chan Event, func()) {
+	ch := make(chan Event, 10)
+
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	if vallox.subscribers == nil {
+		// communication already stopped
+		close(ch)
+		return ch, func() {}
+	}
+	vallox.subscribers[register] = append(vallox.subscribers[register], ch)
+
+	unsubscribe := func() {
+		vallox.mu.Lock()
+		defer vallox.mu.Unlock()
+		subscribers := vallox.subscribers[register]
+		for i, sub := range subscribers {
+			if sub == ch {
+				vallox.subscribers[register] = append(subscribers[:i:i], subscribers[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+	return ch, unsubscribe
+}
+
+// publish sends e to subscribers of its register without blocking
+func publish(vallox *Vallox, e *Event) {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	for _, ch := range vallox.subscribers[e.Register] {
+		select {
+		case ch <- *e:
+		default:
+			incrementStat(&vallox.metrics.SubscriberEventsDropped)
+		}
+	}
+}
+
+// closeSubscribers closes all subscriber channels when communication stops
+func closeSubscribers(vallox *Vallox) {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	for _, subscribers := range vallox.subscribers {
+		for _, ch := range subscribers {
+			close(ch)
+		}
+	}
+	vallox.subscribers = nil
+}
+
+// WaitFor waits for the next event of register or until ctx is done. It does
+// not query the register, combine it with Query or a write as needed.
+func (vallox *Vallox) WaitFor(ctx context.Context, register byte) (Event, error) {
+	ch, unsubscribe := vallox.Subscribe(register)
+	defer unsubscribe()
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			return Event{}, ErrClosed
+		}
+		return e, nil
+	case <-ctx.Done():
+		return Event{}, ctx.Err()
+	}
+}
+
+// QuerySync queries register and waits for a mainboard to send its value or
+// until ctx is done
+func (vallox *Vallox) QuerySync(ctx context.Context, register byte) (Event, error) {
+	ch, unsubscribe := vallox.Subscribe(register)
+	defer unsubscribe()
+	vallox.Query(register)
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return Event{}, ErrClosed
+			}
+			if fromMainboard(e) {
+				return e, nil
+			}
+		case <-ctx.Done():
+			return Event{}, ctx.Err()
+		}
+	}
+}
+
+// ApplyRegister writes value to register like WriteRegister, and waits for the
+// mainboard to report the new value back or until ctx is done. The write to
+// the mainboard is sent right away even if Config.CoalesceWindow is set, and
+// the register is queried after it. The panels are not written if ctx is
+// done by the time the mainboard write has been sent. Returns an error if the
+// mainboard answers the query with a different value.
+func (vallox *Vallox) ApplyRegister(ctx context.Context, register byte, value byte) error {
+	ch, unsubscribe := vallox.Subscribe(register)
+	defer unsubscribe()
+
+	if err := vallox.WriteRegisterContext(ctx, MsgMainboard1, register, value); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("verifying register %x: %w", register, err)
+	}
+	vallox.writeRegister(MsgPanels, register, value)
+	vallox.Query(register)
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return ErrClosed
+			}
+			if !fromMainboard(e) {
+				continue
+			}
+			if e.RawValue == value {
+				return nil
+			}
+			if e.Destination == vallox.RemoteClientId() {
+				// answer to our query
+				return fmt.Errorf("register %x value %x not accepted, mainboard reports %x", register, value, e.RawValue)
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("verifying register %x: %w", register, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	temps, unsubscribe := v.Subscribe(RegisterSupplyTemp)
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x81))
+	if len(temps) != 1 {
+		t.Fatalf("expected 1 subscribed event got %d", len(temps))
+	}
+	if e := <-temps; e.Register != RegisterSupplyTemp || e.RawValue != 0x81 {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	unsubscribe()
+	if _, ok := <-temps; ok {
+		t.Errorf("channel not closed on unsubscribe")
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x82))
+	unsubscribe()
+}
+
+func TestSubscribersClosedOnStop(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{})
+	v.start()
+	ch, unsubscribe := v.Subscribe(RegisterSupplyTemp)
+	v.Close()
+	for range ch {
+	}
+	unsubscribe()
+	if _, ok := <-v.Events(); ok {
+		t.Errorf("events channel not closed")
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	go func() {
+		// wait until subscribed
+		for {
+			v.mu.Lock()
+			n := len(v.subscribers[RegisterRH1])
+			v.mu.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterRH1, 0x90))
+	}()
+	e, err := v.WaitFor(context.Background(), RegisterRH1)
+	if err != nil || e.RawValue != 0x90 {
+		t.Errorf("unexpected event %+v err %v", e, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := v.WaitFor(ctx, RegisterRH1); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded got %v", err)
+	}
+}
+
+func TestQuerySync(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	go func() {
+		// wait until subscribed
+		for {
+			v.mu.Lock()
+			n := len(v.subscribers[RegisterOutdoorTemp])
+			v.mu.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		// panels repeat values too, only a mainboard answers the query
+		feedBuffer(v, testFrame(MsgDomain, 0x21, MsgPanels, RegisterOutdoorTemp, 0x70))
+		feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, v.RemoteClientId(), RegisterOutdoorTemp, 0x80))
+	}()
+	e, err := v.QuerySync(context.Background(), RegisterOutdoorTemp)
+	if err != nil || e.RawValue != 0x80 {
+		t.Errorf("unexpected event %+v err %v", e, err)
+	}
+	if pkg := <-v.out; pkg.Register != 0 || pkg.Value != RegisterOutdoorTemp {
+		t.Errorf("expected query of outdoor temp got %x = %x", pkg.Register, pkg.Value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := v.QuerySync(ctx, RegisterOutdoorTemp); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded got %v", err)
+	}
+}
+
+func TestApplyRegister(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{EnableWrite: true, WritableRegisters: []byte{RegisterPreheatingTemp}})
+	atomic.StoreInt32(&v.running, 1)
+	go handleOutgoing(v)
+	defer v.Close()
+
+	replied := make(chan struct{})
+	reply := func(value byte) {
+		defer close(replied)
+		// answer once the write to the mainboard and panels and the query
+		// have been sent
+		for {
+			port.mu.Lock()
+			n := port.written.Len()
+			port.mu.Unlock()
+			if n >= 3*6 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		port.mu.Lock()
+		written := port.written.Bytes()
+		query := testFrame(MsgDomain, v.RemoteClientId(), MsgMainboard1, 0, RegisterPreheatingTemp)
+		if !bytes.Equal(written[:6], testFrame(MsgDomain, v.RemoteClientId(), MsgMainboard1, RegisterPreheatingTemp, 0x90)) ||
+			!bytes.Equal(written[12:18], query) {
+			t.Errorf("unexpected frames %x", written)
+		}
+		port.written.Reset()
+		port.mu.Unlock()
+		// a panel repeating the old value is not an answer
+		feedBuffer(v, testFrame(MsgDomain, 0x21, MsgPanels, RegisterPreheatingTemp, 0x80))
+		feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, v.RemoteClientId(), RegisterPreheatingTemp, value))
+	}
+
+	go reply(0x90)
+	if err := v.ApplyRegister(context.Background(), RegisterPreheatingTemp, 0x90); err != nil {
+		t.Errorf("apply failed: %v", err)
+	}
+	<-replied
+
+	replied = make(chan struct{})
+	go reply(0x80)
+	if err := v.ApplyRegister(context.Background(), RegisterPreheatingTemp, 0x90); err == nil {
+		t.Errorf("rejected value applied")
+	}
+	<-replied
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := v.ApplyRegister(ctx, RegisterPreheatingTemp, 0x90); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded got %v", err)
+	}
+
+	if err := v.ApplyRegister(context.Background(), RegisterStatus, 0x01); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+}
+
+func TestApplyRegisterCancelledAfterMainboardWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	port := newFakePort()
+	v, _ := newVallox(port, Config{
+		EnableWrite:       true,
+		WritableRegisters: []byte{RegisterPreheatingTemp},
+		// the caller gives up as soon as the mainboard write is sent
+		TraceFrame: func(dir Direction, frame [6]byte, valid bool) {
+			if dir == DirectionOut {
+				cancel()
+			}
+		},
+	})
+	atomic.StoreInt32(&v.running, 1)
+	go handleOutgoing(v)
+	defer v.Close()
+
+	if err := v.ApplyRegister(ctx, RegisterPreheatingTemp, 0x90); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled got %v", err)
+	}
+	if err := v.Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	port.mu.Lock()
+	written := port.written.Bytes()
+	port.mu.Unlock()
+	if !bytes.Equal(written, testFrame(MsgDomain, v.RemoteClientId(), MsgMainboard1, RegisterPreheatingTemp, 0x90)) {
+		t.Errorf("expected only the mainboard write got %x", written)
+	}
+}
@@ -0,0 +1,32 @@
+package valloxrs485
+
+// Direction tells whether a frame was read from or written to the bus
+type Direction int
+
+const (
+	// DirectionIn is a frame read from the bus
+	DirectionIn Direction = iota
+	// DirectionOut is a frame written to the bus by this client
+	DirectionOut
+)
+
+// String returns in or out
+func (dir Direction) String() string {
+	switch dir {
+	case DirectionIn:
+		return "in"
+	case DirectionOut:
+		return "out"
+	}
+	return "unknown"
+}
+
+// traceFrame calls Config.TraceFrame, if set, with the first 6 bytes of buf
+func traceFrame(vallox *Vallox, dir Direction, buf []byte, valid bool) {
+	if vallox.traceFrame == nil {
+		return
+	}
+	var frame [6]byte
+	copy(frame[:], buf)
+	vallox.traceFrame(dir, frame, valid)
+}
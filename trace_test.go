@@ -0,0 +1,56 @@
+package valloxrs485
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type tracedFrame struct {
+	dir   Direction
+	frame [6]byte
+	valid bool
+}
+
+func TestTraceFrame(t *testing.T) {
+	var mu sync.Mutex
+	var traced []tracedFrame
+	trace := func(dir Direction, frame [6]byte, valid bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		traced = append(traced, tracedFrame{dir, frame, valid})
+	}
+	port := newFakePort()
+	v, _ := newVallox(port, Config{TraceFrame: trace})
+
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80)
+	feedBuffer(v, append([]byte{0x00}, frame...))
+	if len(traced) != 2 {
+		t.Fatalf("expected 2 traced frames got %+v", traced)
+	}
+	if traced[0].dir != DirectionIn || traced[0].valid || traced[0].frame[0] != 0x00 {
+		t.Errorf("expected invalid frame at the garbage byte got %+v", traced[0])
+	}
+	if traced[1].dir != DirectionIn || !traced[1].valid || traced[1].frame != EncodeFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80) {
+		t.Errorf("expected valid frame got %+v", traced[1])
+	}
+
+	atomic.StoreInt32(&v.running, 1)
+	go handleOutgoing(v)
+	defer v.Close()
+	v.Query(RegisterSupplyTemp)
+	if err := v.Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	query := createQuery(v, RegisterSupplyTemp)
+	mu.Lock()
+	defer mu.Unlock()
+	last := traced[len(traced)-1]
+	if last.dir != DirectionOut || !last.valid || last.frame != [6]byte{query.System, query.Source, query.Destination, query.Register, query.Value, query.Checksum} {
+		t.Errorf("unexpected outgoing trace %+v", last)
+	}
+	if last.dir.String() != "out" || DirectionIn.String() != "in" {
+		t.Errorf("unexpected direction names")
+	}
+}
@@ -4,12 +4,19 @@ package valloxrs485
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"math"
+	"math/bits"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tarm/serial"
@@ -19,24 +26,183 @@ import (
 type Config struct {
 	// Device file for rs485 device
 	Device string
-	// RemoteClientId is the id for this device in Vallox rs485 bus
+	// RemoteClientId is the id for this device in Vallox rs485 bus, a panel
+	// id 0x21-0x2f, default 0x27
 	RemoteClientId byte
 	// Enable writing to Vallox regisers, default false
 	EnableWrite bool
 	// Logge for debug, default no logging
 	LogDebug *log.Logger
+	// Logger for debug, takes precedence over LogDebug
+	Logger Logger
+	// DropEcho drops incoming frames sent by this client, default false.
+	// Many rs485 adapters echo transmitted frames back to the reader.
+	DropEcho bool
+	// BlockOnFullQueue makes the reader wait for the consumer when the Events
+	// channel is full. By default events are dropped instead so that a slow
+	// consumer never stalls reading the bus, see DroppedEvents.
+	BlockOnFullQueue bool
+	// Promiscuous delivers every valid frame seen on the bus to Events,
+	// bypassing filtering options like DropEcho, and logs each decoded frame
+	// to the debug logger. Can be very noisy, meant for reverse engineering.
+	Promiscuous bool
+	// RawCapture receives each valid frame read from the bus prefixed with
+	// an 8 byte big endian timestamp in nanoseconds since Unix epoch. Writes
+	// are best effort, frames are dropped if the writer is not keeping up.
+	RawCapture io.Writer
+	// StrictAddressing rejects frames whose source or destination is not a
+	// mainboard 0x10-0x1f or panel 0x20-0x2f address, default false
+	StrictAddressing bool
+	// WritableRegisters replaces the default list of registers that can be
+	// written when EnableWrite is true. The default allows only the fan
+	// speeds and program. Setters of other registers, e.g. Boost or
+	// SetPreheatingTemp, need their register listed here together with the
+	// defaults still used. Writing registers or values not supported by the
+	// device may damage it, use at your own risk.
+	WritableRegisters []byte
+	// OnlyForMe delivers only events addressed for this client, see ForMe,
+	// to Events and OnEvent handlers. Latest values and Subscribe still see
+	// all traffic. Ignored in Promiscuous mode.
+	OnlyForMe bool
+	// MaxWritesPerSecond limits the rate of register writes when greater
+	// than zero. Writes exceeding the limit are delayed, not dropped, and wait
+	// in the outgoing queue. Queries are not limited.
+	MaxWritesPerSecond int
+	// CoalesceWindow delays register writes for this long, and a write to
+	// the same register and destination within the window replaces the
+	// value of the delayed one, e.g. for sliders emitting many intermediate
+	// values. Writes to other registers are never dropped. WriteRegisterContext
+	// is not delayed. Default 0 sends every write.
+	CoalesceWindow time.Duration
+	// TempSmoothingWindow is the number of readings averaged for the value
+	// of temperature sensor events, RawValue is not affected. Sensor faults
+	// are passed through unsmoothed. Default 0 and 1 disable smoothing.
+	TempSmoothingWindow int
+	// PollInterval is the interval for querying PollRegisters, for registers
+	// that are only sent when they change. Default 0 disables polling.
+	PollInterval time.Duration
+	// PollRegisters are queried every PollInterval
+	PollRegisters []byte
+	// SilenceTimeout reports ErrBusSilent to Errors when nothing has been read
+	// from the bus for this long. A healthy bus is chatty, silence usually
+	// means a wiring or power problem. Default 0 disables the check.
+	SilenceTimeout time.Duration
+	// StaleAfter queries cached registers not updated for this long, for
+	// values that change slowly and are rarely sent, e.g. the service
+	// counter. Until a fresh value is received the cached event has
+	// Event.Stale set. Default 0 disables the check.
+	StaleAfter time.Duration
+	// IncludeRawFrame sets Event.RawFrame to the received bytes, default false
+	IncludeRawFrame bool
+	// ReadTimeout of serial reads, so that the reader notices Close without
+	// waiting for traffic. Default 1 second, negative waits forever.
+	ReadTimeout time.Duration
+	// AutoClientId makes Open observe the bus for this long before sending
+	// anything and pick a RemoteClientId not used by the panels seen. The
+	// configured RemoteClientId is kept if it is free. Default 0 uses
+	// RemoteClientId as is.
+	AutoClientId time.Duration
+	// DryRun validates and logs register writes but does not send them to
+	// the bus. Use together with EnableWrite and a debug Logger. Queries are
+	// still sent so that values can be read.
+	DryRun bool
+	// OutQueueSize is the number of frames queued for sending before
+	// writes wait for the queue, default 100
+	OutQueueSize int
+	// ByteSize is the number of data bits 5-8 of the serial port, default 8
+	ByteSize byte
+	// Parity of the serial port, 'N' none, 'E' even or 'O' odd, default 'N'
+	Parity byte
+	// StopBits of the serial port, 1 or 2, default 1
+	StopBits byte
+	// Decoders replace the decoding of Event.Value for the registers in the
+	// map, e.g. for registers used differently by some models. A decoder
+	// overrides the built-in decoding of its register, so Event.Value no
+	// longer has the built-in type like Temperature or FanSpeed. The typed
+	// accessors of the register, e.g. OutdoorTemp, CurrentFanSpeed or
+	// HeatingState, then return ok false. Get still returns the decoded
+	// event with RawValue unchanged.
+	Decoders map[byte]func(byte) interface{}
+	// TraceFrame is called with every frame read and written, e.g. for a
+	// live view of the bus. Frames read are called with valid false when the
+	// checksum or addresses are invalid, and while resynchronizing once for
+	// every byte discarded, with the 6 bytes starting at it. It is called
+	// from the reading and writing goroutines and must return quickly.
+	// Default nil.
+	TraceFrame func(dir Direction, frame [6]byte, valid bool)
 }
 
 type Vallox struct {
-	port           *serial.Port
-	remoteClientId byte
-	running        bool
-	buffer         *bufio.ReadWriter
-	in             chan Event
-	out            chan valloxPackage
-	lastActivity   time.Time
-	writeAllowed   bool
-	logDebug       *log.Logger
+	// metrics is first to keep the counters 64-bit aligned for atomic access
+	metrics Metrics
+	// seq is the sequence number of the latest event, after metrics to keep
+	// it 64-bit aligned
+	seq             uint64
+	port            io.ReadWriteCloser
+	remoteClientId  byte
+	running         int32
+	done            chan struct{}
+	closeOnce       sync.Once
+	boostMu         sync.Mutex
+	boostTimer      *time.Timer
+	boostUntil      time.Time
+	boostGeneration uint64
+	buffer          *bufio.ReadWriter
+	rawBuffer       *bytes.Buffer
+	in              chan Event
+	dispatch        chan Event
+	handlers        []func(Event)
+	cache           map[byte]Event
+	subscribers     map[byte][]chan Event
+	out             chan outgoing
+	mu              sync.Mutex
+	lastActivity    time.Time
+	writeAllowed    bool
+	writable        map[byte]bool
+	onlyForMe       bool
+	writeLimit      *tokenBucket
+	dropEcho        bool
+	blockOnFull     bool
+	promiscuous     bool
+	strictAddresses bool
+	capture         chan captureRecord
+	captureWriter   io.Writer
+	resyncing       bool
+	logDebug        Logger
+	tempWindow      int
+	tempReadings    map[byte][]int8
+	pollInterval    time.Duration
+	pollRegisters   []byte
+	errors          chan error
+	lastRead        time.Time
+	silenceTimeout  time.Duration
+	staleAfter      time.Duration
+	includeRawFrame bool
+	readTimeout     time.Duration
+	lifecycle       chan LifecycleEvent
+	fireplaceSwitch chan Event
+	autoClientId    time.Duration
+	dryRun          bool
+	skipInit        bool
+	coalesceWindow  time.Duration
+	coalesced       map[coalesceKey]valloxPackage
+	decoders        map[byte]func(byte) interface{}
+	traceFrame      func(dir Direction, frame [6]byte, valid bool)
+	// modifyMu serializes modifyRegister
+	modifyMu sync.Mutex
+	// overflow has the registers waiting to be queried by sendOverflow
+	overflow []byte
+	// written has the values written by modifyRegister not yet reported by
+	// a mainboard
+	written map[byte]byte
+	// now returns the current time, time.Now unless replaced by tests
+	now func() time.Time
+	// seenPanels has bit n set when panel 0x20+n has been seen sending
+	seenPanels uint32
+	// pending is the number of frames queued or being sent, see Flush
+	pending int32
+	// paused is 1 while event delivery is paused, see Pause
+	paused int32
 }
 
 const (
@@ -48,6 +214,9 @@ const (
 	MsgPanels     = 0x20
 )
 
+// busQuietTime is how long the bus must be idle before transmitting
+const busQuietTime = 50 * time.Millisecond
+
 // Registers based on Vallox documentation
 const (
 	RegisterIO07                 byte = 0x07
@@ -94,7 +263,7 @@ const (
 	RegisterProgram2             byte = 0xb5
 )
 
-// Flags of variable 08
+// Flags of variable 07
 const (
 	IO07FlagReheating byte = 0x20
 )
@@ -121,6 +290,55 @@ const (
 	FanSpeed8 byte = 0xff
 )
 
+// FanSpeed is a decoded fan speed step from 1 to 8. Zero means the raw
+// value did not match any known speed pattern.
+type FanSpeed int8
+
+// IsValid returns true if the speed is one of the known steps 1-8
+func (speed FanSpeed) IsValid() bool {
+	return speed >= 1 && int(speed) <= len(fanSpeedConversion)
+}
+
+// RawPattern returns the raw register value of the speed, e.g. FanSpeed3 for
+// speed 3, or 0 if the speed is not valid
+func (speed FanSpeed) RawPattern() byte {
+	if !speed.IsValid() {
+		return 0
+	}
+	return fanSpeedConversion[speed-1]
+}
+
+// FanSpeedFromRaw converts a raw register value to a speed. Returns false if
+// the value is not a known speed pattern.
+func FanSpeedFromRaw(value byte) (FanSpeed, bool) {
+	for i, v := range fanSpeedConversion {
+		if value == v {
+			return FanSpeed(i + 1), true
+		}
+	}
+	return 0, false
+}
+
+// TempSensorFault is the lowest raw temperature sensor value meaning a
+// disconnected or faulty sensor. Raw values 0xf7-0xff all convert to 100 °C.
+const TempSensorFault byte = 0xf7
+
+// Temperature is a decoded temperature in degrees Celsius. Fault is set when
+// a temperature sensor reports a raw value of TempSensorFault or above, or
+// RegisterFaultCode reports a fault of the sensor, see IsSensorFault.
+type Temperature struct {
+	Celsius int8
+	Fault   bool
+}
+
+// MarshalJSON encodes the temperature as a number, or null for a faulty sensor
+func (temp Temperature) MarshalJSON() ([]byte, error) {
+	if temp.Fault {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.Itoa(int(temp.Celsius))), nil
+}
+
 const RHOffset = 51
 const RHDivider = 2.04
 
@@ -188,6 +406,11 @@ const (
 	ProgramFlagCascadeControl    byte = 0x80
 )
 
+// programFlagMask has the bits of RegisterProgram holding ProgramFlags, the
+// other bits hold the humidity and CO2 adjustment interval
+const programFlagMask = ProgramFlagAutomaticHumidity | ProgramFlagBoostSwitch |
+	ProgramFlagWater | ProgramFlagCascadeControl
+
 const (
 	Program2FlagMaximumSpeedLimit byte = 0x01
 )
@@ -199,8 +422,46 @@ type Event struct {
 	Register    byte        `json:"register"`
 	RawValue    byte        `json:"raw"`
 	Value       interface{} `json:"value"`
+	// Seq is the sequence number of the event, increasing by one for every
+	// event decoded from the bus. Gaps tell about events dropped from a full
+	// queue, or not delivered because of Config.OnlyForMe or Pause. Zero for
+	// events not read from the bus, e.g. from DecodeFrame.
+	Seq uint64 `json:"seq,omitempty"`
+	// Stale is set on a cached event, e.g. from Get or Snapshot, that is older
+	// than Config.StaleAfter. Its register has been queried and the flag is
+	// cleared when a fresh value is received. Events delivered from the bus
+	// are never stale.
+	Stale bool `json:"stale,omitempty"`
+	// RawFrame is the frame as received including the checksum, set only
+	// when Config.IncludeRawFrame is enabled
+	RawFrame [6]byte `json:"-"`
+}
+
+// Broadcast returns true if the event was sent to all the panels or all the
+// mainboards instead of a single device
+func (e Event) Broadcast() bool {
+	return e.Destination == MsgPanels || e.Destination == MsgMainboards
 }
 
+// MarshalJSON encodes the event with register name and unit of the value
+func (e Event) MarshalJSON() ([]byte, error) {
+	type plainEvent Event
+	var rawFrame string
+	if e.RawFrame != ([6]byte{}) {
+		rawFrame = hex.EncodeToString(e.RawFrame[:])
+	}
+	return json.Marshal(struct {
+		plainEvent
+		RegisterName string `json:"register_name"`
+		Unit         string `json:"unit"`
+		RawFrame     string `json:"raw_frame,omitempty"`
+	}{plainEvent(e), RegisterName(e.Register), RegisterUnit(e.Register), rawFrame})
+}
+
+// valloxPackage is a frame in wire order. All the fields are single bytes, so
+// binary.Write writes them in declaration order whatever byte order it is
+// given, and validPackage reads them back in the same order. A multi-byte
+// field would make the byte order given to binary.Write significant.
 type valloxPackage struct {
 	System      byte
 	Source      byte
@@ -210,6 +471,13 @@ type valloxPackage struct {
 	Checksum    byte
 }
 
+// ErrWriteDisabled is returned by setters when Config.EnableWrite is false
+var ErrWriteDisabled = errors.New("writing is not enabled")
+
+// ErrRegisterNotWritable is returned when writing a register that is not
+// allowed, see Config.WritableRegisters
+var ErrRegisterNotWritable = errors.New("register is not writable")
+
 var writeAllowed = map[byte]bool{
 	RegisterCurrentFanSpeed: true,
 	RegisterMaxFanSpeed:     true,
@@ -219,161 +487,868 @@ var writeAllowed = map[byte]bool{
 
 // Open opens the rs485 device specified in Config
 func Open(cfg Config) (*Vallox, error) {
+	return open(cfg, true)
+}
+
+// serialConfig returns the serial port settings of cfg, 9600 8N1 by default
+func serialConfig(cfg Config) (*serial.Config, error) {
+	if cfg.ByteSize == 0 {
+		cfg.ByteSize = 8
+	}
+	if cfg.Parity == 0 {
+		cfg.Parity = 'N'
+	}
+	if cfg.StopBits == 0 {
+		cfg.StopBits = 1
+	}
+	if cfg.ByteSize < 5 || cfg.ByteSize > 8 {
+		return nil, fmt.Errorf("invalid byte size %d", cfg.ByteSize)
+	}
+	switch cfg.Parity {
+	case 'N', 'E', 'O':
+	default:
+		return nil, fmt.Errorf("invalid parity %q", cfg.Parity)
+	}
+	if cfg.StopBits != 1 && cfg.StopBits != 2 {
+		return nil, fmt.Errorf("invalid stop bits %d", cfg.StopBits)
+	}
+	return &serial.Config{
+		Name:        cfg.Device,
+		Baud:        9600,
+		Size:        cfg.ByteSize,
+		Parity:      serial.Parity(cfg.Parity),
+		StopBits:    serial.StopBits(cfg.StopBits),
+		ReadTimeout: cfg.ReadTimeout,
+	}, nil
+}
+
+// open opens the rs485 device and starts communication. With init all the
+// known registers are queried.
+func open(cfg Config, init bool) (*Vallox, error) {
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = time.Second
+	} else if cfg.ReadTimeout < 0 {
+		cfg.ReadTimeout = 0
+	}
+	portCfg, err := serialConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	port, err := serial.OpenPort(portCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	vallox, err := newVallox(port, cfg)
+	if err != nil {
+		port.Close()
+		return nil, err
+	}
+	vallox.skipInit = !init
+
+	if err := vallox.start(); err != nil {
+		vallox.Close()
+		return nil, err
+	}
 
-	if cfg.LogDebug == nil {
-		cfg.LogDebug = log.New(ioutil.Discard, "", 0)
+	return vallox, nil
+}
+
+// newVallox creates a Vallox communicating through port without starting it
+func newVallox(port io.ReadWriteCloser, cfg Config) (*Vallox, error) {
+
+	if cfg.Logger == nil {
+		if cfg.LogDebug != nil {
+			cfg.Logger = StdLogger(cfg.LogDebug)
+		} else {
+			cfg.Logger = nopLogger{}
+		}
 	}
 
 	if cfg.RemoteClientId == 0 {
 		cfg.RemoteClientId = 0x27
 	}
 
-	if cfg.RemoteClientId < 0x20 || cfg.RemoteClientId > 0x2f {
+	if !validClientId(cfg.RemoteClientId) {
 		return nil, fmt.Errorf("invalid remoteClientId %x", cfg.RemoteClientId)
 	}
 
-	portCfg := &serial.Config{Name: cfg.Device, Baud: 9600, Size: 8, Parity: 'N', StopBits: 1}
-	port, err := serial.OpenPort(portCfg)
-	if err != nil {
-		return nil, err
+	if cfg.OutQueueSize <= 0 {
+		cfg.OutQueueSize = 100
 	}
 
 	buffer := new(bytes.Buffer)
 	vallox := &Vallox{
 		port:           port,
-		running:        true,
+		done:           make(chan struct{}),
 		buffer:         bufio.NewReadWriter(bufio.NewReader(buffer), bufio.NewWriter(buffer)),
+		rawBuffer:      buffer,
 		remoteClientId: cfg.RemoteClientId,
 		// Queue size should be greater than count of sendInit messages
-		in:           make(chan Event, 100),
-		out:          make(chan valloxPackage, 100),
-		writeAllowed: cfg.EnableWrite,
-		logDebug:     cfg.LogDebug,
+		in:              make(chan Event, 100),
+		dispatch:        make(chan Event, 100),
+		cache:           make(map[byte]Event),
+		written:         make(map[byte]byte),
+		subscribers:     make(map[byte][]chan Event),
+		out:             make(chan outgoing, cfg.OutQueueSize),
+		errors:          make(chan error, 10),
+		lifecycle:       make(chan LifecycleEvent, 10),
+		fireplaceSwitch: make(chan Event, 10),
+		silenceTimeout:  cfg.SilenceTimeout,
+		staleAfter:      cfg.StaleAfter,
+		includeRawFrame: cfg.IncludeRawFrame,
+		traceFrame:      cfg.TraceFrame,
+		readTimeout:     cfg.ReadTimeout,
+		autoClientId:    cfg.AutoClientId,
+		dryRun:          cfg.DryRun,
+		writeAllowed:    cfg.EnableWrite,
+		dropEcho:        cfg.DropEcho,
+		blockOnFull:     cfg.BlockOnFullQueue,
+		promiscuous:     cfg.Promiscuous,
+		onlyForMe:       cfg.OnlyForMe,
+		strictAddresses: cfg.StrictAddressing,
+		logDebug:        cfg.Logger,
+		now:             time.Now,
+	}
+
+	if cfg.WritableRegisters != nil {
+		vallox.writable = make(map[byte]bool, len(cfg.WritableRegisters))
+		for _, register := range cfg.WritableRegisters {
+			vallox.writable[register] = true
+		}
+	}
+
+	if cfg.MaxWritesPerSecond > 0 {
+		vallox.writeLimit = newTokenBucket(cfg.MaxWritesPerSecond, vallox.now())
 	}
 
-	sendInit(vallox)
+	if len(cfg.Decoders) > 0 {
+		vallox.decoders = make(map[byte]func(byte) interface{}, len(cfg.Decoders))
+		for register, decode := range cfg.Decoders {
+			vallox.decoders[register] = decode
+		}
+	}
+
+	if cfg.CoalesceWindow > 0 {
+		vallox.coalesceWindow = cfg.CoalesceWindow
+		vallox.coalesced = make(map[coalesceKey]valloxPackage)
+	}
+
+	if cfg.PollInterval > 0 && len(cfg.PollRegisters) > 0 {
+		vallox.pollInterval = cfg.PollInterval
+		vallox.pollRegisters = append([]byte(nil), cfg.PollRegisters...)
+	}
+
+	if cfg.TempSmoothingWindow > 1 {
+		vallox.tempWindow = cfg.TempSmoothingWindow
+		vallox.tempReadings = make(map[byte][]int8)
+	}
+
+	if cfg.RawCapture != nil {
+		vallox.capture = make(chan captureRecord, 100)
+		vallox.captureWriter = cfg.RawCapture
+	}
+
+	return vallox, nil
+}
+
+// start queries the initial values and starts the bus goroutines
+func (vallox *Vallox) start() error {
+	vallox.startBus()
+	if vallox.autoClientId > 0 {
+		if err := detectClientId(vallox); err != nil {
+			return err
+		}
+	}
+	if !vallox.skipInit {
+		sendInit(vallox)
+	}
+	if vallox.pollInterval > 0 {
+		go pollRegisters(vallox)
+	}
+	if vallox.silenceTimeout > 0 {
+		go watchSilence(vallox)
+	}
+	if vallox.staleAfter > 0 {
+		go watchStale(vallox)
+	}
+	return nil
+}
+
+// startBus starts the bus goroutines
+func (vallox *Vallox) startBus() {
+	atomic.StoreInt32(&vallox.running, 1)
 
 	go handleIncoming(vallox)
 	go handleOutgoing(vallox)
+	go dispatchEvents(vallox)
+	if vallox.capture != nil {
+		go handleCapture(vallox)
+	}
+	notifyLifecycle(vallox, StateConnected, nil)
+}
 
-	return vallox, nil
+// Close stops communication and closes the rs485 device
+func (vallox *Vallox) Close() error {
+	if stop(vallox) {
+		notifyLifecycle(vallox, StateDisconnected, nil)
+	}
+	var err error
+	vallox.closeOnce.Do(func() {
+		err = vallox.port.Close()
+	})
+	return err
 }
 
-// Events returns channel for events from Vallox bus
-func (vallox Vallox) Events() chan Event {
+// Running returns true until the bus is closed or a fatal error occurs
+func (vallox *Vallox) Running() bool {
+	return atomic.LoadInt32(&vallox.running) == 1
+}
+
+// Events returns channel for events from Vallox bus. The channel is closed
+// when communication stops.
+func (vallox *Vallox) Events() chan Event {
 	return vallox.in
 }
 
-// ForMe returns true if event is addressed for this client
-func (vallox Vallox) ForMe(e Event) bool {
-	return e.Destination == MsgPanels || e.Destination == vallox.remoteClientId
+// Errors returns channel for errors that do not stop communication, like
+// ErrBusSilent, and the error stopping it. Errors are dropped if the channel
+// is full.
+func (vallox *Vallox) Errors() <-chan error {
+	return vallox.errors
+}
+
+// OnEvent registers fn to be called for every event from Vallox bus. Handlers
+// are called one at a time from a dedicated goroutine, in registration order
+// and in the order the events were received. Events are delivered to handlers
+// in addition to the Events channel.
+func (vallox *Vallox) OnEvent(fn func(Event)) {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	vallox.handlers = append(vallox.handlers, fn)
+}
+
+// Pause stops delivering events to Events and OnEvent handlers until Resume.
+// Frames are still read, so the latest values, Subscribe and the bus
+// activity stay current. Events received while paused are not delivered
+// later.
+func (vallox *Vallox) Pause() {
+	atomic.StoreInt32(&vallox.paused, 1)
+}
+
+// Resume continues delivering events after Pause
+func (vallox *Vallox) Resume() {
+	atomic.StoreInt32(&vallox.paused, 0)
+}
+
+// Paused returns true if event delivery is paused
+func (vallox *Vallox) Paused() bool {
+	return atomic.LoadInt32(&vallox.paused) == 1
+}
+
+// DroppedEvents returns count of events dropped because the Events channel was
+// full. Drops for OnEvent handlers and Subscribe channels are counted
+// separately in Metrics.
+func (vallox *Vallox) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&vallox.metrics.EventsDropped)
+}
+
+// RemoteClientId returns the id of this client in the bus
+func (vallox *Vallox) RemoteClientId() byte {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	return vallox.remoteClientId
+}
+
+// SetRemoteClientId changes the id of this client in the bus to 0x21-0x2f,
+// used as the source of the following frames and by ForMe
+func (vallox *Vallox) SetRemoteClientId(id byte) error {
+	if !validClientId(id) {
+		return fmt.Errorf("invalid remoteClientId %x", id)
+	}
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	vallox.remoteClientId = id
+	return nil
+}
+
+// ForMe returns true if event is addressed for this client, either broadcast
+// to all the panels or directed to this client
+func (vallox *Vallox) ForMe(e Event) bool {
+	return e.Destination == MsgPanels || vallox.DirectedToMe(e)
+}
+
+// DirectedToMe returns true if event is addressed to this client only, e.g. an
+// answer to a query sent by this client
+func (vallox *Vallox) DirectedToMe(e Event) bool {
+	return e.Destination == vallox.RemoteClientId()
 }
 
 // Query queries Vallox for register
-func (vallox Vallox) Query(register byte) {
+func (vallox *Vallox) Query(register byte) {
 	pkg := createQuery(vallox, register)
-	vallox.out <- *pkg
+	vallox.enqueue(pkg)
 }
 
-// SetSpeed changes speed of ventilation fan
-func (vallox Vallox) SetSpeed(speed byte) {
-	if speed < 1 || speed > 8 {
-		vallox.logDebug.Printf("received invalid speed %x", speed)
+// QueryAll queries each of registers in order. Queries that do not fit in
+// the outgoing queue are queued in the background, so the call never blocks.
+// A register already waiting to be queued in the background is not queried
+// twice.
+func (vallox *Vallox) QueryAll(registers ...byte) {
+	vallox.mu.Lock()
+	overflowing := len(vallox.overflow) > 0
+	vallox.mu.Unlock()
+	if overflowing {
+		// keep the order, the queue is probably still full
+		queueOverflow(vallox, registers)
 		return
 	}
-	value := speedToValue(int8(speed))
-	vallox.logDebug.Printf("received set speed %x", speed)
-	// Send value to the main vallox device
-	vallox.writeRegister(MsgMainboard1, RegisterCurrentFanSpeed, value)
-	// Also publish value to all the remotes
-	vallox.writeRegister(MsgPanels, RegisterCurrentFanSpeed, value)
+	for i, register := range registers {
+		atomic.AddInt32(&vallox.pending, 1)
+		select {
+		case vallox.out <- outgoing{valloxPackage: *createQuery(vallox, register)}:
+		default:
+			atomic.AddInt32(&vallox.pending, -1)
+			queueOverflow(vallox, registers[i:])
+			return
+		}
+	}
 }
 
-// SetDefaultFanSpeed changes default speed of ventilation fan
-func (vallox Vallox) SetDefaultFanSpeed(speed byte) {
-	if speed < 1 || speed > 8 {
-		vallox.logDebug.Printf("received invalid speed %x", speed)
-		return
+// queueOverflow adds the registers not already waiting to the queries queued
+// in the background, and starts the single background sender if needed. The
+// waiting queries count as pending for Flush.
+func queueOverflow(vallox *Vallox, registers []byte) {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	start := len(vallox.overflow) == 0
+	for _, register := range registers {
+		if bytes.IndexByte(vallox.overflow, register) >= 0 {
+			continue
+		}
+		vallox.overflow = append(vallox.overflow, register)
+		atomic.AddInt32(&vallox.pending, 1)
+	}
+	if start && len(vallox.overflow) > 0 {
+		go sendOverflow(vallox)
 	}
-	value := speedToValue(int8(speed))
-	vallox.logDebug.Printf("received set speed %x", speed)
-	// Send value to the main vallox device
-	vallox.writeRegister(MsgMainboard1, RegisterDefaultFanSpeed, value)
-	// Also publish value to all the remotes
-	vallox.writeRegister(MsgPanels, RegisterDefaultFanSpeed, value)
+}
+
+// sendOverflow queues the waiting queries one at a time until there are none
+// left or the instance is closed. Each register stays waiting until it has
+// been queued, so that it is not queried twice and no other sender is
+// started meanwhile.
+func sendOverflow(vallox *Vallox) {
+	vallox.mu.Lock()
+	register := vallox.overflow[0]
+	vallox.mu.Unlock()
+	for {
+		select {
+		case vallox.out <- outgoing{valloxPackage: *createQuery(vallox, register)}:
+		case <-vallox.done:
+			vallox.mu.Lock()
+			atomic.AddInt32(&vallox.pending, -int32(len(vallox.overflow)))
+			vallox.overflow = nil
+			vallox.mu.Unlock()
+			return
+		}
+
+		vallox.mu.Lock()
+		vallox.overflow = vallox.overflow[1:]
+		if len(vallox.overflow) == 0 {
+			vallox.mu.Unlock()
+			return
+		}
+		register = vallox.overflow[0]
+		vallox.mu.Unlock()
+	}
+}
+
+// RefreshAll queries all the known registers again, e.g. after a reconnect
+func (vallox *Vallox) RefreshAll() {
+	vallox.QueryAll(initRegisters...)
+}
+
+// SetSpeed changes speed of ventilation fan
+func (vallox *Vallox) SetSpeed(speed FanSpeed) error {
+	return vallox.setFanSpeed(RegisterCurrentFanSpeed, speed)
+}
+
+// SetDefaultFanSpeed changes default speed of ventilation fan
+func (vallox *Vallox) SetDefaultFanSpeed(speed FanSpeed) error {
+	return vallox.setFanSpeed(RegisterDefaultFanSpeed, speed)
 }
 
 // SetMaxFanSpeed changes maximum speed of ventilation fan
-func (vallox Vallox) SetMaxFanSpeed(speed byte) {
-	if speed < 1 || speed > 8 {
-		vallox.logDebug.Printf("received invalid speed %x", speed)
-		return
+func (vallox *Vallox) SetMaxFanSpeed(speed FanSpeed) error {
+	return vallox.setFanSpeed(RegisterMaxFanSpeed, speed)
+}
+
+// SetSpeedFor changes speed of ventilation fan of a single mainboard or
+// panel, see WriteRegisterTo
+func (vallox *Vallox) SetSpeedFor(destination byte, speed FanSpeed) error {
+	if !speed.IsValid() {
+		return fmt.Errorf("invalid speed %d", speed)
 	}
-	value := speedToValue(int8(speed))
-	vallox.logDebug.Printf("received set speed %x", speed)
-	// Send value to the main vallox device
-	vallox.writeRegister(MsgMainboard1, RegisterMaxFanSpeed, value)
-	// Also publish value to all the remotes
-	vallox.writeRegister(MsgPanels, RegisterMaxFanSpeed, value)
+	return vallox.WriteRegisterTo(destination, RegisterCurrentFanSpeed, speed.RawPattern())
+}
+
+// SetSpeedPercent changes speed of ventilation fan to the speed nearest to
+// percent 0-100, see PercentToSpeed. The speed is limited to the max fan
+// speed if it has been received from the bus.
+func (vallox *Vallox) SetSpeedPercent(percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("invalid speed percent %d", percent)
+	}
+	speed := PercentToSpeed(percent)
+	if raw, ok := vallox.cachedRaw(RegisterMaxFanSpeed); ok {
+		if max := decodeMaxFanSpeed(raw); max.IsValid() && speed > max {
+			speed = max
+		}
+	}
+	return vallox.SetSpeed(speed)
+}
+
+// SetSpeedAndVerify changes speed of ventilation fan and queries the speed
+// back from the mainboard, returning an error if the mainboard reports a
+// different speed or does not answer within timeout
+func (vallox *Vallox) SetSpeedAndVerify(speed FanSpeed, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ch, unsubscribe := vallox.Subscribe(RegisterCurrentFanSpeed)
+	defer unsubscribe()
+
+	if err := vallox.SetSpeed(speed); err != nil {
+		return err
+	}
+	if vallox.coalesceWindow > 0 {
+		// the query must not overtake the held write
+		if err := vallox.Flush(timeout); err != nil {
+			return fmt.Errorf("verifying speed %d: %w", speed, err)
+		}
+	}
+	vallox.Query(RegisterCurrentFanSpeed)
+
+	expected := speed.RawPattern()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return ErrClosed
+			}
+			if !fromMainboard(e) {
+				continue
+			}
+			if e.RawValue == expected {
+				return nil
+			}
+			if e.Destination == vallox.RemoteClientId() {
+				// answer to our query
+				return fmt.Errorf("speed %d not accepted, mainboard reports %v", speed, e.Value)
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("verifying speed %d: %w", speed, ctx.Err())
+		}
+	}
+}
+
+func (vallox *Vallox) setFanSpeed(register byte, speed FanSpeed) error {
+	if !speed.IsValid() {
+		vallox.logDebug.Debugf("received invalid speed %x", speed)
+		return fmt.Errorf("invalid speed %d", speed)
+	}
+	vallox.logDebug.Debugf("received set speed %x = %x", register, speed)
+	return vallox.setRegister(register, speed.RawPattern())
+}
+
+// SetServiceInterval changes the interval of the filter change reminder to
+// months 1-12. RegisterServiceInterval is not writable by default, it must be
+// allowed with Config.WritableRegisters.
+func (vallox *Vallox) SetServiceInterval(months byte) error {
+	if months < 1 || months > 12 {
+		return fmt.Errorf("invalid service interval %d", months)
+	}
+	vallox.logDebug.Debugf("received set service interval %d", months)
+	return vallox.setRegister(RegisterServiceInterval, months)
+}
+
+// SetPreheatingTemp changes the outdoor temperature below which preheating
+// is used. The setting affects frost protection, RegisterPreheatingTemp is not
+// writable by default, it must be allowed with Config.WritableRegisters.
+func (vallox *Vallox) SetPreheatingTemp(celsius int8) error {
+	return vallox.setTemp(RegisterPreheatingTemp, celsius)
+}
+
+// SetSupplyFanStopTemp changes the outdoor temperature below which the supply
+// fan is stopped. The setting affects frost protection,
+// RegisterSupplyFanStopTemp is not writable by default, it must be allowed
+// with Config.WritableRegisters.
+func (vallox *Vallox) SetSupplyFanStopTemp(celsius int8) error {
+	return vallox.setTemp(RegisterSupplyFanStopTemp, celsius)
+}
+
+// SetSupplyFanSetpoint changes the supply fan setpoint for balancing the
+// airflow to percent 0-100. RegisterSupplyFanSetpoint is not writable by
+// default, it must be allowed with Config.WritableRegisters.
+func (vallox *Vallox) SetSupplyFanSetpoint(percent byte) error {
+	return vallox.setFanSetpoint(RegisterSupplyFanSetpoint, percent)
+}
+
+// SetExhaustFanSetpoint changes the exhaust fan setpoint for balancing the
+// airflow to percent 0-100. RegisterExhaustFanSetpoint is not writable by
+// default, it must be allowed with Config.WritableRegisters.
+func (vallox *Vallox) SetExhaustFanSetpoint(percent byte) error {
+	return vallox.setFanSetpoint(RegisterExhaustFanSetpoint, percent)
+}
+
+// setFanSetpoint writes percent to a fan setpoint register of the mainboard
+func (vallox *Vallox) setFanSetpoint(register byte, percent byte) error {
+	if percent > 100 {
+		return fmt.Errorf("invalid fan setpoint %d", percent)
+	}
+	vallox.logDebug.Debugf("received set fan setpoint %x = %d", register, percent)
+	return vallox.WriteRegisterTo(MsgMainboard1, register, percent)
+}
+
+// setTemp writes celsius to a temperature register, see TempToValue
+func (vallox *Vallox) setTemp(register byte, celsius int8) error {
+	value, err := tempToValue(int(celsius))
+	if err != nil {
+		return err
+	}
+	vallox.logDebug.Debugf("received set temperature %x = %d", register, celsius)
+	return vallox.setRegister(register, value)
+}
+
+// ResetFireplaceCounter writes zero to the remaining minutes of the fireplace
+// switch. RegisterFireplaceCounter is not writable by default, it must be
+// allowed with Config.WritableRegisters.
+func (vallox *Vallox) ResetFireplaceCounter() error {
+	return vallox.resetCounter(RegisterFireplaceCounter)
+}
+
+// ResetServiceCounter writes zero to the months since the last service, e.g.
+// after changing the filters. RegisterServiceCounter is not writable by
+// default, it must be allowed with Config.WritableRegisters.
+func (vallox *Vallox) ResetServiceCounter() error {
+	return vallox.resetCounter(RegisterServiceCounter)
+}
+
+// resetCounter writes zero to a counter register if it is allowed
+func (vallox *Vallox) resetCounter(register byte) error {
+	vallox.logDebug.Debugf("reset counter %x", register)
+	return vallox.setRegister(register, 0)
+}
+
+// SetAntiFreezeHysteresis changes the hysteresis of the heat recovery cell
+// anti-freeze function in degrees Celsius 1-10. RegisterAntiFreezeHysteresis
+// is not writable by default, it must be allowed with Config.WritableRegisters.
+func (vallox *Vallox) SetAntiFreezeHysteresis(value byte) error {
+	if value < 1 || value > 10 {
+		return fmt.Errorf("invalid anti-freeze hysteresis %d", value)
+	}
+	vallox.logDebug.Debugf("received set anti-freeze hysteresis %d", value)
+	return vallox.setRegister(RegisterAntiFreezeHysteresis, value)
+}
+
+// WriteEnabled returns true if writing registers is enabled with
+// Config.EnableWrite
+func (vallox *Vallox) WriteEnabled() bool {
+	return vallox.writeAllowed
+}
+
+// CanWrite returns true if register can be written, i.e. writing is enabled
+// and the register is allowed by Config.WritableRegisters or by default
+func (vallox *Vallox) CanWrite(register byte) bool {
+	return register != 0 && vallox.checkWritable(register) == nil
+}
+
+// checkWritable returns an error if register is not allowed to be written
+func (vallox *Vallox) checkWritable(register byte) error {
+	if !vallox.writeAllowed {
+		return ErrWriteDisabled
+	}
+	if !isOutgoingAllowed(vallox, register) {
+		return ErrRegisterNotWritable
+	}
+	return nil
+}
+
+// SetProgramFlag sets or clears a single ProgramFlag* bit of RegisterProgram
+// keeping the other flags. The current program value must have been received
+// from the bus before calling this.
+func (vallox *Vallox) SetProgramFlag(flag byte, on bool) error {
+	if flag == 0 || flag&^programFlagMask != 0 {
+		return fmt.Errorf("invalid program flag %x", flag)
+	}
+	return vallox.modifyRegister(RegisterProgram, func(current byte) byte {
+		value := current &^ flag
+		if on {
+			value |= flag
+		}
+		vallox.logDebug.Debugf("received set program flag %x = %v, program %x -> %x", flag, on, current, value)
+		return value
+	})
+}
+
+// SetProgram writes all the flags of RegisterProgram at once, keeping the
+// other bits of the register. Get the current flags from the bus and change
+// them to avoid clearing flags by accident, or use SetProgramFlag to change
+// only one. The current program value must have been received from the bus
+// before calling this.
+func (vallox *Vallox) SetProgram(flags ProgramFlags) error {
+	return vallox.modifyRegister(RegisterProgram, func(current byte) byte {
+		value := current&^programFlagMask | flags.Byte()
+		vallox.logDebug.Debugf("received set program %+v, program %x -> %x", flags, current, value)
+		return value
+	})
+}
+
+// SetMaximumSpeedLimit sets or clears Program2FlagMaximumSpeedLimit keeping
+// the other bits of RegisterProgram2. The current program2 value must have
+// been received from the bus before calling this. RegisterProgram2 is not
+// writable by default, it must be allowed with Config.WritableRegisters.
+func (vallox *Vallox) SetMaximumSpeedLimit(on bool) error {
+	return vallox.modifyRegister(RegisterProgram2, func(current byte) byte {
+		value := current &^ Program2FlagMaximumSpeedLimit
+		if on {
+			value |= Program2FlagMaximumSpeedLimit
+		}
+		vallox.logDebug.Debugf("received set maximum speed limit %v, program2 %x -> %x", on, current, value)
+		return value
+	})
+}
+
+// initRegisters are the known registers queried by sendInit and RefreshAll
+var initRegisters = []byte{
+	RegisterIO07,
+	RegisterIO08,
+	RegisterCurrentFanSpeed,
+	RegisterMaxRH,
+	RegisterCurrentCO2,
+	RegisterMaximumCO2,
+	RegisterCO2Status,
+	RegisterMessage,
+	RegisterRH1,
+	RegisterRH2,
+	RegisterOutdoorTemp,
+	RegisterExhaustOutTemp,
+	RegisterExhaustInTemp,
+	RegisterSupplyTemp,
+	RegisterFaultCode,
+	RegisterPostHeatingOnTime,
+	RegisterPostHeatingOffTime,
+	RegisterPostHeatingTarget,
+	RegisterFlags02,
+	RegisterFlags04,
+	RegisterFlags05,
+	RegisterFlags06,
+	RegisterFireplaceCounter,
+	RegisterStatus,
+	RegisterPostHeatingSetpoint,
+	RegisterMaxFanSpeed,
+	RegisterServiceInterval,
+	RegisterPreheatingTemp,
+	RegisterSupplyFanStopTemp,
+	RegisterDefaultFanSpeed,
+	RegisterProgram,
+	RegisterServiceCounter,
+	RegisterBasicHumidity,
+	RegisterBypassTemp,
+	RegisterSupplyFanSetpoint,
+	RegisterExhaustFanSetpoint,
+	RegisterAntiFreezeHysteresis,
+	RegisterCO2SetpointUpper,
+	RegisterCO2SetpointLower,
+	RegisterProgram2,
 }
 
 // Query all known registers
 func sendInit(vallox *Vallox) {
-	vallox.Query(RegisterIO07)
-	vallox.Query(RegisterIO08)
-	vallox.Query(RegisterCurrentFanSpeed)
-	vallox.Query(RegisterMaxRH)
-	vallox.Query(RegisterCurrentCO2)
-	vallox.Query(RegisterMaximumCO2)
-	vallox.Query(RegisterCO2Status)
-	vallox.Query(RegisterMessage)
-	vallox.Query(RegisterRH1)
-	vallox.Query(RegisterRH2)
-	vallox.Query(RegisterOutdoorTemp)
-	vallox.Query(RegisterExhaustOutTemp)
-	vallox.Query(RegisterExhaustInTemp)
-	vallox.Query(RegisterSupplyTemp)
-	vallox.Query(RegisterFaultCode)
-	vallox.Query(RegisterPostHeatingOnTime)
-	vallox.Query(RegisterPostHeatingOffTime)
-	vallox.Query(RegisterPostHeatingTarget)
-	vallox.Query(RegisterFlags02)
-	vallox.Query(RegisterFlags04)
-	vallox.Query(RegisterFlags05)
-	vallox.Query(RegisterFlags06)
-	vallox.Query(RegisterFireplaceCounter)
-	vallox.Query(RegisterStatus)
-	vallox.Query(RegisterPostHeatingSetpoint)
-	vallox.Query(RegisterMaxFanSpeed)
-	vallox.Query(RegisterServiceInterval)
-	vallox.Query(RegisterPreheatingTemp)
-	vallox.Query(RegisterSupplyFanStopTemp)
-	vallox.Query(RegisterDefaultFanSpeed)
-	vallox.Query(RegisterProgram)
-	vallox.Query(RegisterServiceCounter)
-	vallox.Query(RegisterBasicHumidity)
-	vallox.Query(RegisterBypassTemp)
-	vallox.Query(RegisterSupplyFanSetpoint)
-	vallox.Query(RegisterExhaustFanSetpoint)
-	vallox.Query(RegisterAntiFreezeHysteresis)
-	vallox.Query(RegisterCO2SetpointUpper)
-	vallox.Query(RegisterCO2SetpointLower)
-	vallox.Query(RegisterProgram2)
-}
-
-func (vallox Vallox) writeRegister(destination byte, register byte, value byte) {
+	// queries not fitting in the out queue are sent in the background, so
+	// that Open does not wait for them
+	vallox.QueryAll(initRegisters...)
+}
+
+// setRegister writes value to the main vallox device and all the remotes
+func (vallox *Vallox) setRegister(register byte, value byte) error {
+	if err := vallox.checkWritable(register); err != nil {
+		// fail here instead of queueing a frame handleOutgoing would drop
+		return err
+	}
+	// Send value to the main vallox device
+	vallox.writeRegister(MsgMainboard1, register, value)
+	// Also publish value to all the remotes
+	vallox.writeRegister(MsgPanels, register, value)
+	return nil
+}
+
+// modifyRegister writes the value returned by modify for the current value of
+// register to the mainboard and the panels. Until a mainboard reports the
+// register, the current value is the one last written here instead of the
+// cached one, so that changes made in a row do not undo each other.
+func (vallox *Vallox) modifyRegister(register byte, modify func(current byte) byte) error {
+	vallox.modifyMu.Lock()
+	defer vallox.modifyMu.Unlock()
+
+	vallox.mu.Lock()
+	current, ok := vallox.written[register]
+	if !ok {
+		var e Event
+		e, ok = vallox.cache[register]
+		current = e.RawValue
+	}
+	vallox.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("current %s value is not known", RegisterName(register))
+	}
+
+	value := modify(current)
+	if err := vallox.setRegister(register, value); err != nil {
+		return err
+	}
+	vallox.mu.Lock()
+	vallox.written[register] = value
+	vallox.mu.Unlock()
+	return nil
+}
+
+// WriteRegister writes raw value to register of the main vallox device and
+// all the remotes. Returns ErrWriteDisabled if writing is not enabled, or
+// ErrRegisterNotWritable if register is not allowed by
+// Config.WritableRegisters.
+func (vallox *Vallox) WriteRegister(register byte, value byte) error {
+	return vallox.setRegister(register, value)
+}
+
+// WriteRegisterTo writes raw value to register of a single mainboard
+// 0x11-0x1f or panel 0x21-0x2f, see WriteRegister
+func (vallox *Vallox) WriteRegisterTo(destination byte, register byte, value byte) error {
+	if err := vallox.checkWritable(register); err != nil {
+		return err
+	}
+	if !deviceAddress(destination) {
+		return fmt.Errorf("invalid destination %x", destination)
+	}
+	vallox.writeRegister(destination, register, value)
+	return nil
+}
+
+func (vallox *Vallox) writeRegister(destination byte, register byte, value byte) {
 	pkg := createWrite(vallox, destination, register, value)
-	vallox.out <- *pkg
+	if vallox.coalesceWindow > 0 {
+		coalesceWrite(vallox, pkg)
+		return
+	}
+	vallox.enqueue(pkg)
 }
 
-func createQuery(vallox Vallox, register byte) *valloxPackage {
+// WriteRegisterContext writes raw value to register of a single mainboard
+// 0x11-0x1f or panel 0x21-0x2f and waits until the frame has been sent. Gives
+// up when ctx is done before writing the frame has begun, the frame is then
+// never sent. Returns ErrRegisterNotWritable for registers not allowed by
+// Config.WritableRegisters.
+func (vallox *Vallox) WriteRegisterContext(ctx context.Context, destination byte, register byte, value byte) error {
+	if err := vallox.checkWritable(register); err != nil {
+		return err
+	}
+	if !deviceAddress(destination) {
+		return fmt.Errorf("invalid destination %x", destination)
+	}
+	result := make(chan error, 1)
+	req := outgoing{
+		valloxPackage: *createWrite(vallox, destination, register, value),
+		ctx:           ctx,
+		result:        result,
+		state:         new(int32),
+	}
+	atomic.AddInt32(&vallox.pending, 1)
+	select {
+	case vallox.out <- req:
+	case <-ctx.Done():
+		atomic.AddInt32(&vallox.pending, -1)
+		return ctx.Err()
+	case <-vallox.done:
+		atomic.AddInt32(&vallox.pending, -1)
+		return ErrClosed
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if req.cancel() {
+			return ctx.Err()
+		}
+		// writing has begun, sendOutgoing reports how it ended
+		return <-result
+	case <-vallox.done:
+		return ErrClosed
+	}
+}
+
+const (
+	outgoingQueued int32 = iota
+	outgoingSending
+	outgoingCancelled
+)
+
+// outgoing is a frame queued for sending
+type outgoing struct {
+	valloxPackage
+	// ctx cancels sending, nil if the frame is sent regardless
+	ctx context.Context
+	// result receives the outcome of sending, nil if nobody is waiting
+	result chan<- error
+	// state is outgoingQueued until writing begins or the caller cancels,
+	// nil if the frame cannot be cancelled once queued
+	state *int32
+}
+
+// cancel marks req cancelled so that it is never written. Returns false if
+// writing has already begun.
+func (req *outgoing) cancel() bool {
+	return atomic.CompareAndSwapInt32(req.state, outgoingQueued, outgoingCancelled)
+}
+
+// begin marks req being written. Returns false if it was cancelled.
+func (req *outgoing) begin() bool {
+	return req.state == nil || atomic.CompareAndSwapInt32(req.state, outgoingQueued, outgoingSending)
+}
+
+// done reports the outcome of sending req to the waiting caller, if any
+func (req *outgoing) done(err error) {
+	if req.result != nil {
+		req.result <- err
+	}
+}
+
+// context returns the context of req, background if it has none
+func (req *outgoing) context() context.Context {
+	if req.ctx == nil {
+		return context.Background()
+	}
+	return req.ctx
+}
+
+// enqueue queues pkg for sending, unless the bus has been stopped
+func (vallox *Vallox) enqueue(pkg *valloxPackage) {
+	atomic.AddInt32(&vallox.pending, 1)
+	select {
+	case vallox.out <- outgoing{valloxPackage: *pkg}:
+	case <-vallox.done:
+		atomic.AddInt32(&vallox.pending, -1)
+	}
+}
+
+func createQuery(vallox *Vallox, register byte) *valloxPackage {
 	return createWrite(vallox, MsgMainboard1, 0, register)
 }
 
-func createWrite(vallox Vallox, destination byte, register byte, value byte) *valloxPackage {
+func createWrite(vallox *Vallox, destination byte, register byte, value byte) *valloxPackage {
 	pkg := new(valloxPackage)
 	pkg.System = 1
-	pkg.Source = vallox.remoteClientId
+	pkg.Source = vallox.RemoteClientId()
 	pkg.Destination = destination
 	pkg.Register = register
 	pkg.Value = value
@@ -382,22 +1357,110 @@ func createWrite(vallox Vallox, destination byte, register byte, value byte) *va
 }
 
 func handleOutgoing(vallox *Vallox) {
-	for vallox.running {
-		pkg := <-vallox.out
-
-		if !isOutgoingAllowed(vallox, pkg.Register) {
-			vallox.logDebug.Printf("outgoing not allowed for %x = %x", pkg.Register, pkg.Value)
-			continue
+	for vallox.Running() {
+		var req outgoing
+		select {
+		case req = <-vallox.out:
+		case <-vallox.done:
+			return
 		}
+		ok := sendOutgoing(vallox, &req)
+		atomic.AddInt32(&vallox.pending, -1)
+		if !ok {
+			return
+		}
+	}
+}
+
+// sendOutgoing writes req to the bus unless it is not allowed or cancelled.
+// Returns false if the bus was stopped while waiting.
+func sendOutgoing(vallox *Vallox, req *outgoing) bool {
+	pkg := &req.valloxPackage
+	ctx := req.context()
+
+	if !isOutgoingAllowed(vallox, pkg.Register) {
+		vallox.logDebug.Debugf("outgoing not allowed for %x = %x", pkg.Register, pkg.Value)
+		req.done(ErrRegisterNotWritable)
+		return true
+	}
+	if err := ctx.Err(); err != nil {
+		vallox.logDebug.Debugf("outgoing to %x %x = %x cancelled: %v", pkg.Destination, pkg.Register, pkg.Value, err)
+		req.done(err)
+		return true
+	}
+
+	err := waitWriteLimit(vallox, ctx, pkg)
+	if err == ErrClosed {
+		return false
+	}
+	if err == nil && !req.begin() {
+		// the caller gave up while the frame was queued
+		err = ctx.Err()
+	}
+	if err != nil {
+		vallox.logDebug.Debugf("outgoing to %x %x = %x cancelled: %v", pkg.Destination, pkg.Register, pkg.Value, err)
+		req.done(err)
+		return true
+	}
+	if vallox.dryRun && pkg.Register != 0 {
+		vallox.logDebug.Debugf("dry run, not writing %x %x = %x", pkg.Destination, pkg.Register, pkg.Value)
+		req.done(nil)
+		return true
+	}
+	if err := waitQuietBus(vallox, ctx, pkg); err != nil {
+		vallox.logDebug.Debugf("outgoing to %x %x = %x cancelled: %v", pkg.Destination, pkg.Register, pkg.Value, err)
+		req.done(err)
+		return true
+	}
+	updateLastActivity(vallox)
+	if err := binary.Write(vallox.port, binary.BigEndian, pkg); err != nil {
+		vallox.logDebug.Debugf("error writing %x %x = %x: %v", pkg.Destination, pkg.Register, pkg.Value, err)
+		req.done(err)
+		return true
+	}
+	if vallox.traceFrame != nil {
+		vallox.traceFrame(DirectionOut, [6]byte{pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value, pkg.Checksum}, true)
+	}
+	incrementStat(&vallox.metrics.FramesSent)
+	req.done(nil)
+	return true
+}
 
-		now := time.Now()
-		if vallox.lastActivity.IsZero() || now.UnixMilli()-vallox.lastActivity.UnixMilli() < 50 {
-			vallox.logDebug.Printf("delay outgoing to %x %x = %x, lastActivity %v now %v, diff %d ms",
-				pkg.Destination, pkg.Register, pkg.Value, vallox.lastActivity, now, now.UnixMilli()-vallox.lastActivity.UnixMilli())
-			time.Sleep(time.Millisecond * 50)
+// waitQuietBus waits until the bus has been quiet for busQuietTime. Returns
+// the error of ctx if it is done first, or ErrClosed if the bus is stopped.
+func waitQuietBus(vallox *Vallox, ctx context.Context, pkg *valloxPackage) error {
+	lastActivity := getLastActivity(vallox)
+	if lastActivity.IsZero() {
+		// nothing seen on the bus yet, give it a moment
+		vallox.logDebug.Debugf("delay outgoing to %x %x = %x, no activity seen", pkg.Destination, pkg.Register, pkg.Value)
+		return sleepContext(vallox, ctx, busQuietTime)
+	}
+	for {
+		quiet := vallox.now().Sub(lastActivity)
+		if quiet >= busQuietTime {
+			return nil
+		}
+		vallox.logDebug.Debugf("delay outgoing to %x %x = %x, lastActivity %v, quiet for %d ms",
+			pkg.Destination, pkg.Register, pkg.Value, lastActivity, quiet.Milliseconds())
+		if err := sleepContext(vallox, ctx, busQuietTime-quiet); err != nil {
+			return err
 		}
-		updateLastActivity(vallox)
-		binary.Write(vallox.port, binary.BigEndian, pkg)
+		// traffic may have appeared while sleeping
+		lastActivity = getLastActivity(vallox)
+	}
+}
+
+// sleepContext sleeps for d unless ctx is done or the bus is stopped first
+func sleepContext(vallox *Vallox, ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-vallox.done:
+		return ErrClosed
 	}
 }
 
@@ -411,20 +1474,28 @@ func isOutgoingAllowed(vallox *Vallox, register byte) bool {
 		return false
 	}
 
+	if vallox.writable != nil {
+		return vallox.writable[register]
+	}
 	return writeAllowed[register]
 }
 
 func handleIncoming(vallox *Vallox) {
-	vallox.running = true
+	defer close(vallox.in)
+	defer closeSubscribers(vallox)
 	buf := make([]byte, 6)
-	for vallox.running {
+	for vallox.Running() {
 		n, err := vallox.port.Read(buf)
+		if err == io.EOF && vallox.readTimeout > 0 {
+			// read timed out without data, check if still running
+			continue
+		}
 		if err != nil {
 			fatalError(err, vallox)
 			return
 		}
 		if n > 0 {
-			updateLastActivity(vallox)
+			updateLastRead(vallox)
 			vallox.buffer.Write(buf[:n])
 			vallox.buffer.Writer.Flush()
 			handleBuffer(vallox)
@@ -433,53 +1504,230 @@ func handleIncoming(vallox *Vallox) {
 }
 
 func updateLastActivity(vallox *Vallox) {
-	vallox.lastActivity = time.Now()
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	vallox.lastActivity = vallox.now()
+}
+
+// updateLastRead records data read from the bus, which is also activity
+func updateLastRead(vallox *Vallox) {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	vallox.lastActivity = vallox.now()
+	vallox.lastRead = vallox.lastActivity
+}
+
+func getLastRead(vallox *Vallox) time.Time {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	return vallox.lastRead
+}
+
+func getLastActivity(vallox *Vallox) time.Time {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	return vallox.lastActivity
 }
 
 func fatalError(err error, vallox *Vallox) {
-	vallox.running = false
+	if stop(vallox) {
+		vallox.logDebug.Debugf("stopping after fatal error: %v", err)
+		reportError(vallox, err)
+		notifyLifecycle(vallox, StateDisconnected, err)
+	}
+}
+
+// stop marks the bus stopped, returns false if it was already stopped
+func stop(vallox *Vallox) bool {
+	if !atomic.CompareAndSwapInt32(&vallox.running, 1, 0) {
+		return false
+	}
+	close(vallox.done)
+	return true
 }
 
 func handleBuffer(vallox *Vallox) {
 	for {
-		buf, err := vallox.buffer.Peek(6)
-		if err != nil && err == io.EOF {
-			// not enough bytes, ok, continue
+		if bufferedBytes(vallox) < 6 {
+			// not enough bytes for a frame, wait for more
+			compactBuffer(vallox)
 			return
-		} else if err != nil {
+		}
+		buf, err := vallox.buffer.Peek(6)
+		if err != nil {
 			fatalError(err, vallox)
 			return
 		}
-		pkg := validPackage(buf)
-		if pkg != nil {
+		pkg, ok := validPackage(buf)
+		if ok && vallox.strictAddresses && !validAddresses(&pkg) {
+			ok = false
+		}
+		traceFrame(vallox, DirectionIn, buf, ok)
+		if ok {
+			captureFrame(vallox, buf)
 			vallox.buffer.Discard(6)
-			handlePackage(pkg, vallox)
+			vallox.resyncing = false
+			incrementStat(&vallox.metrics.FramesRead)
+			handlePackage(&pkg, vallox)
 		} else {
+			if !vallox.resyncing {
+				vallox.resyncing = true
+				incrementStat(&vallox.metrics.ChecksumErrors)
+			}
 			// discard byte, since no valid package starts here
 			vallox.buffer.ReadByte()
+			incrementStat(&vallox.metrics.BytesDiscarded)
 		}
 	}
 }
 
+// bufferedBytes returns count of received bytes not yet handled
+func bufferedBytes(vallox *Vallox) int {
+	return vallox.buffer.Reader.Buffered() + vallox.rawBuffer.Len()
+}
+
+// compactBuffer releases the space of consumed bytes once the buffer is drained
+func compactBuffer(vallox *Vallox) {
+	if vallox.buffer.Reader.Buffered() == 0 && vallox.rawBuffer.Len() == 0 {
+		vallox.rawBuffer.Reset()
+	}
+}
+
 func handlePackage(pkg *valloxPackage, vallox *Vallox) {
-	vallox.in <- *event(pkg, vallox)
+	recordPanel(vallox, pkg.Source)
+	if filtered(pkg, vallox) {
+		return
+	}
+	event := decodeEvent(pkg, vallox)
+	event.Seq = atomic.AddUint64(&vallox.seq, 1)
+	e := &event
+	smoothTemp(vallox, e)
+	if vallox.promiscuous {
+		vallox.logDebug.Debugf("frame %x -> %x register %x = %x (%v)", e.Source, e.Destination, e.Register, e.RawValue, e.Value)
+	}
+	notifyFireplaceSwitch(vallox, e)
+	updateCache(vallox, e)
+	publish(vallox, e)
+	if vallox.Paused() {
+		return
+	}
+	if vallox.onlyForMe && !vallox.promiscuous && !vallox.ForMe(*e) {
+		return
+	}
+	if deliver(vallox, vallox.in, e, &vallox.metrics.EventsDropped) {
+		incrementStat(&vallox.metrics.EventsDelivered)
+	}
+	if hasHandlers(vallox) {
+		deliver(vallox, vallox.dispatch, e, &vallox.metrics.HandlerEventsDropped)
+	}
+}
+
+// filtered returns true if pkg should not be handled according to config
+func filtered(pkg *valloxPackage, vallox *Vallox) bool {
+	if vallox.promiscuous {
+		return false
+	}
+	if vallox.dropEcho && pkg.Source == vallox.RemoteClientId() {
+		// echo of our own frame
+		return true
+	}
+	return false
+}
+
+// deliver sends e to ch, or drops it counting the drop in dropped if ch is full
+// and blocking is not enabled. A blocked send gives up when the instance is
+// closed.
+func deliver(vallox *Vallox, ch chan Event, e *Event, dropped *uint64) bool {
+	if vallox.blockOnFull {
+		select {
+		case ch <- *e:
+			return true
+		case <-vallox.done:
+			return false
+		}
+	}
+	select {
+	case ch <- *e:
+		return true
+	default:
+		incrementStat(dropped)
+		vallox.logDebug.Debugf("event queue full, dropped %x = %x", e.Register, e.RawValue)
+		return false
+	}
+}
+
+func hasHandlers(vallox *Vallox) bool {
+	vallox.mu.Lock()
+	defer vallox.mu.Unlock()
+	return len(vallox.handlers) > 0
 }
 
-func event(pkg *valloxPackage, vallox *Vallox) *Event {
-	event := new(Event)
-	event.Time = time.Now()
+func dispatchEvents(vallox *Vallox) {
+	for {
+		select {
+		case e := <-vallox.dispatch:
+			vallox.mu.Lock()
+			handlers := vallox.handlers
+			vallox.mu.Unlock()
+			for _, fn := range handlers {
+				fn(e)
+			}
+		case <-vallox.done:
+			return
+		}
+	}
+}
+
+// decodeEvent decodes pkg into an Event, vallox may be nil
+func decodeEvent(pkg *valloxPackage, vallox *Vallox) Event {
+	var event Event
+	if vallox != nil {
+		event.Time = vallox.now()
+	} else {
+		event.Time = time.Now()
+	}
 	event.Source = pkg.Source
 	event.Destination = pkg.Destination
 	event.Register = pkg.Register
 	event.RawValue = pkg.Value
+	if vallox != nil && vallox.includeRawFrame {
+		event.RawFrame = [6]byte{pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value, pkg.Checksum}
+	}
+	if vallox != nil {
+		if decode, ok := vallox.decoders[pkg.Register]; ok {
+			event.Value = decode(pkg.Value)
+			return event
+		}
+	}
 	switch pkg.Register {
+	// Flag conversion
+	case RegisterIO07:
+		event.Value = decodeIO07(pkg.Value)
+	case RegisterIO08:
+		event.Value = decodeIO08(pkg.Value)
+	case RegisterCO2Status:
+		event.Value = decodeCO2Status(pkg.Value)
+	case RegisterFlags02:
+		event.Value = decodeFlags02(pkg.Value)
+	case RegisterMessage:
+		event.Value = Message(pkg.Value)
+	case RegisterFlags04:
+		event.Value = decodeFlags04(pkg.Value)
+	case RegisterFlags05:
+		event.Value = decodeFlags05(pkg.Value)
+	case RegisterFlags06:
+		event.Value = decodeFlags06(pkg.Value)
+	case RegisterProgram:
+		event.Value = decodeProgram(pkg.Value)
+	case RegisterProgram2:
+		event.Value = decodeProgram2(pkg.Value)
 	// Speed conversion
 	case RegisterCurrentFanSpeed:
 		fallthrough
-	case RegisterMaxFanSpeed:
-		fallthrough
 	case RegisterDefaultFanSpeed:
-		event.Value = int16(valueToSpeed(pkg.Value))
+		event.Value = decodeFanSpeed(pkg.Value)
+	case RegisterMaxFanSpeed:
+		event.Value = decodeMaxFanSpeed(pkg.Value)
 	// RH conversion
 	case RegisterMaxRH:
 		fallthrough
@@ -488,8 +1736,10 @@ func event(pkg *valloxPackage, vallox *Vallox) *Event {
 	case RegisterRH2:
 		fallthrough
 	case RegisterBasicHumidity:
-		event.Value = math.Round(float64(valueToRh(pkg.Value))*100) / 100
-	// Temperature conversion
+		// basic humidity is the configured baseline level, not a measurement,
+		// but it is scaled like the sensors
+		event.Value = decodeRh(pkg.Value)
+	// Temperature sensor conversion
 	case RegisterOutdoorTemp:
 		fallthrough
 	case RegisterExhaustOutTemp:
@@ -497,20 +1747,34 @@ func event(pkg *valloxPackage, vallox *Vallox) *Event {
 	case RegisterExhaustInTemp:
 		fallthrough
 	case RegisterSupplyTemp:
-		fallthrough
+		temp := decodeSensorTemp(pkg.Value)
+		if vallox != nil && faultCodeReported(vallox, pkg.Register) {
+			temp.Fault = true
+		}
+		event.Value = temp
+	// Post-heating temperatures: the target is the supply air temperature the
+	// mainboard is currently heating to, the setpoint is the configured
+	// value. Both use the same NTC scale as the temperature sensors.
 	case RegisterPostHeatingTarget:
 		fallthrough
 	case RegisterPostHeatingSetpoint:
-		fallthrough
+		event.Value = Temperature{Celsius: valueToTemp(pkg.Value)}
+	// Temperature conversion
 	case RegisterPreheatingTemp:
 		fallthrough
+	case RegisterSupplyFanStopTemp:
+		fallthrough
 	case RegisterBypassTemp:
-		event.Value = int16(valueToTemp(pkg.Value))
+		event.Value = Temperature{Celsius: valueToTemp(pkg.Value)}
 	// Percentage conversion
 	case RegisterPostHeatingOnTime:
 		fallthrough
 	case RegisterPostHeatingOffTime:
-		event.Value = float64(pkg.Value) / 2.5
+		event.Value = decodePostHeatingTime(pkg.Value)
+	case RegisterSupplyFanSetpoint:
+		fallthrough
+	case RegisterExhaustFanSetpoint:
+		event.Value = float64(pkg.Value)
 	// Plain value
 	default:
 		event.Value = int16(pkg.Value)
@@ -518,36 +1782,193 @@ func event(pkg *valloxPackage, vallox *Vallox) *Event {
 	return event
 }
 
-func valueToSpeed(value byte) int8 {
-	for i, v := range fanSpeedConversion {
-		if value == v {
-			return int8(i) + 1
-		}
+// ValueToSpeed converts a raw fan speed value to speed 1-8, or -1 if the value
+// is not a known speed pattern
+func ValueToSpeed(value byte) int {
+	if speed, ok := FanSpeedFromRaw(value); ok {
+		return int(speed)
 	}
 	return -1
 }
 
+// SpeedToValue converts speed 1-8 to a raw fan speed value, or 0 if the speed
+// is out of range
+func SpeedToValue(speed int) byte {
+	if speed < 1 || speed > len(fanSpeedConversion) {
+		return 0
+	}
+	return FanSpeed(speed).RawPattern()
+}
+
+// SpeedToPercent converts speed 1-8 to percent of the maximum speed,
+// round(speed / 8 * 100), e.g. 1 is 13% and 4 is 50%
+func SpeedToPercent(speed int) int {
+	return int(math.Round(float64(speed) / float64(len(fanSpeedConversion)) * 100))
+}
+
+// PercentToSpeed converts percent to the nearest speed 1-8, the reverse of
+// SpeedToPercent. Percents below 13 give speed 1 and above 100 speed 8.
+func PercentToSpeed(percent int) FanSpeed {
+	speed := int(math.Round(float64(percent) / 100 * float64(len(fanSpeedConversion))))
+	if speed < 1 {
+		return 1
+	}
+	if speed > len(fanSpeedConversion) {
+		return FanSpeed(len(fanSpeedConversion))
+	}
+	return FanSpeed(speed)
+}
+
+// ValueToRH converts a raw humidity value to relative humidity in percent,
+// (value - RHOffset) / RHDivider. Values below RHOffset are 0%. The same
+// scaling is used by the sensors and the basic humidity setpoint.
+func ValueToRH(value byte) float64 {
+	if value < RHOffset {
+		return 0
+	}
+	return (float64(value) - RHOffset) / RHDivider
+}
+
+// RHToValue converts relative humidity percent 0-100 to the raw value
+// nearest to it, the reverse of ValueToRH. The resolution is 1/RHDivider, about
+// 0.5%.
+func RHToValue(rh float64) (byte, error) {
+	if rh < 0 || rh > 100 || math.IsNaN(rh) {
+		return 0, fmt.Errorf("humidity %v out of range", rh)
+	}
+	return byte(math.Round(rh*RHDivider + RHOffset)), nil
+}
+
+// ValueToTemp converts a raw temperature value to degrees Celsius
+func ValueToTemp(value byte) int8 {
+	return tempConversion[value]
+}
+
+// TempToValue converts degrees Celsius to the raw temperature value nearest to
+// it. Returns an error if celsius is outside the range of the conversion
+// table, -74 to 97, values from TempSensorFault up are not used. The table
+// has 1 °C steps from -44 to 57 °C and steps of up to 4 °C outside that, so
+// the value may decode up to 2 °C off at the ends of the range.
+func TempToValue(celsius int) (byte, error) {
+	if celsius < int(tempConversion[0]) || celsius > int(tempConversion[TempSensorFault-1]) {
+		return 0, fmt.Errorf("temperature %d out of range", celsius)
+	}
+	best := 0
+	for value := 1; value < int(TempSensorFault); value++ {
+		if abs(int(tempConversion[value])-celsius) < abs(int(tempConversion[best])-celsius) {
+			best = value
+		}
+	}
+	return byte(best), nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func valueToSpeed(value byte) int8 {
+	return int8(ValueToSpeed(value))
+}
+
+func decodeFanSpeed(value byte) FanSpeed {
+	// unknown patterns, e.g. transitional values on the bus, decode to 0
+	speed, _ := FanSpeedFromRaw(value)
+	return speed
+}
+
+// decodeMaxFanSpeed decodes the max fan speed as the number of enabled
+// steps. The raw value has a bit set for each enabled step, so a pattern not
+// in the table, e.g. 0x05 from a model with fewer steps, maps to the step of
+// its highest set bit. Only 0 decodes to the invalid speed 0.
+func decodeMaxFanSpeed(value byte) FanSpeed {
+	return FanSpeed(bits.Len8(value))
+}
+
 func speedToValue(speed int8) byte {
-	return fanSpeedConversion[speed-1]
+	return FanSpeed(speed).RawPattern()
 }
 
 func valueToRh(value byte) float64 {
-	return (float64(value) + RHOffset) / RHDivider
+	return ValueToRH(value)
+}
+
+func rhToValue(rh float64) (byte, error) {
+	return RHToValue(rh)
+}
+
+func decodeRh(value byte) float64 {
+	return math.Round(valueToRh(value)*100) / 100
+}
+
+// decodePostHeatingTime converts a post-heating on or off time to percent
+func decodePostHeatingTime(value byte) float64 {
+	return float64(value) / 2.5
+}
+
+func decodeSensorTemp(value byte) Temperature {
+	return Temperature{Celsius: valueToTemp(value), Fault: value >= TempSensorFault}
 }
 
 func valueToTemp(value byte) int8 {
-	return tempConversion[value]
+	return ValueToTemp(value)
 }
 
-func validPackage(buffer []byte) (pkg *valloxPackage) {
-	pkg = new(valloxPackage)
-	err := binary.Read(bytes.NewReader(buffer), binary.LittleEndian, pkg)
+func tempToValue(celsius int) (byte, error) {
+	return TempToValue(celsius)
+}
 
-	if err == nil && validChecksum(pkg) {
-		return pkg
+// DecodeFrame decodes the first 6 bytes of buf into an Event the same way as
+// received frames are decoded, with RawFrame set and Time of the call. Returns
+// false if buf does not start with a valid frame.
+func DecodeFrame(buf []byte) (Event, bool) {
+	pkg, ok := validPackage(buf)
+	if !ok {
+		return Event{}, false
 	}
+	e := decodeEvent(&pkg, nil)
+	copy(e.RawFrame[:], buf)
+	return e, true
+}
 
-	return nil
+// validPackage parses the frame at the start of buffer, returns false if
+// there is no valid frame. The package is returned by value so that scanning
+// noise byte by byte does not allocate.
+func validPackage(buffer []byte) (valloxPackage, bool) {
+	if len(buffer) < 6 {
+		return valloxPackage{}, false
+	}
+	pkg := valloxPackage{
+		System:      buffer[0],
+		Source:      buffer[1],
+		Destination: buffer[2],
+		Register:    buffer[3],
+		Value:       buffer[4],
+		Checksum:    buffer[5],
+	}
+	return pkg, pkg.System == MsgDomain && validChecksum(&pkg)
+}
+
+// fromMainboard returns true if e was sent by a mainboard
+func fromMainboard(e Event) bool {
+	return e.Source >= MsgMainboards && e.Source < MsgPanels
+}
+
+// validAddresses returns true if source and destination are known bus addresses
+func validAddresses(pkg *valloxPackage) bool {
+	return validAddress(pkg.Source) && validAddress(pkg.Destination)
+}
+
+func validAddress(address byte) bool {
+	return address >= MsgMainboards && address <= 0x2f
+}
+
+// deviceAddress returns true if address is a single mainboard or panel, not
+// the MsgMainboards or MsgPanels broadcast
+func deviceAddress(address byte) bool {
+	return validAddress(address) && address != MsgMainboards && address != MsgPanels
 }
 
 func validChecksum(pkg *valloxPackage) bool {
@@ -555,7 +1976,19 @@ func validChecksum(pkg *valloxPackage) bool {
 }
 
 func calculateChecksum(pkg *valloxPackage) byte {
-	return pkg.System + pkg.Source + pkg.Destination + pkg.Register + pkg.Value
+	return Checksum(pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value)
+}
+
+// Checksum returns the checksum of a frame, the sum of all the other bytes
+// modulo 256. The byte addition wraps around on purpose.
+func Checksum(system, source, destination, register, value byte) byte {
+	return system + source + destination + register + value
+}
+
+// EncodeFrame returns a frame with a valid checksum as sent on the bus.
+// A query has register 0 and the queried register as value.
+func EncodeFrame(system, source, destination, register, value byte) [6]byte {
+	return [6]byte{system, source, destination, register, value, Checksum(system, source, destination, register, value)}
 }
 
 var fanSpeedConversion = [8]byte{
@@ -1,18 +1,41 @@
 package valloxrs485
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/quick"
+	"time"
 )
 
 func TestOutGoingAllowed(t *testing.T) {
 	v := new(Vallox)
 	assertBoolean(true, isOutgoingAllowed(v, 0), t)
-	assertBoolean(false, isOutgoingAllowed(v, FanSpeed), t)
-	assertBoolean(false, isOutgoingAllowed(v, TempIncomingInside), t)
+	assertBoolean(false, isOutgoingAllowed(v, RegisterCurrentFanSpeed), t)
+	assertBoolean(false, isOutgoingAllowed(v, RegisterSupplyTemp), t)
 	v.writeAllowed = true
 	assertBoolean(true, isOutgoingAllowed(v, 0), t)
-	assertBoolean(true, isOutgoingAllowed(v, FanSpeed), t)
-	assertBoolean(false, isOutgoingAllowed(v, TempIncomingInside), t)
+	assertBoolean(true, isOutgoingAllowed(v, RegisterCurrentFanSpeed), t)
+	assertBoolean(false, isOutgoingAllowed(v, RegisterSupplyTemp), t)
+}
+
+func TestWritableRegisters(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterBypassTemp}})
+	assertBoolean(true, isOutgoingAllowed(v, 0), t)
+	assertBoolean(true, isOutgoingAllowed(v, RegisterBypassTemp), t)
+	assertBoolean(false, isOutgoingAllowed(v, RegisterCurrentFanSpeed), t)
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{}})
+	assertBoolean(false, isOutgoingAllowed(v, RegisterCurrentFanSpeed), t)
 }
 
 func TestValueToTemp(t *testing.T) {
@@ -22,6 +45,171 @@ func TestValueToTemp(t *testing.T) {
 	assertTemp(247, 100, t)
 }
 
+func TestTempToValue(t *testing.T) {
+	for _, celsius := range []int{-74, -20, 0, 21, 97} {
+		value, err := tempToValue(celsius)
+		if err != nil {
+			t.Errorf("temp %d rejected: %v", celsius, err)
+		} else if c := valueToTemp(value); int(c) != celsius {
+			t.Errorf("temp %d converted to %x and back to %d", celsius, value, c)
+		}
+	}
+	for _, celsius := range []int{-75, 98, 100, 200} {
+		if value, err := tempToValue(celsius); err == nil {
+			t.Errorf("temp %d accepted as %x", celsius, value)
+		}
+	}
+}
+
+func TestSensorTempFault(t *testing.T) {
+	if temp := decodeSensorTemp(246); temp.Fault || temp.Celsius != 97 {
+		t.Errorf("raw 246 was not decoded to 97 but to %+v", temp)
+	}
+	if temp := decodeSensorTemp(TempSensorFault); !temp.Fault {
+		t.Errorf("raw %d was not decoded as fault", TempSensorFault)
+	}
+	if b, _ := json.Marshal(Temperature{Celsius: 100, Fault: true}); string(b) != "null" {
+		t.Errorf("faulty temperature encoded as %s", b)
+	}
+	if b, _ := json.Marshal(Temperature{Celsius: -5}); string(b) != "-5" {
+		t.Errorf("temperature encoded as %s", b)
+	}
+}
+
+func TestEventJSON(t *testing.T) {
+	e := Event{
+		Time:        time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC),
+		Source:      MsgMainboard1,
+		Destination: MsgPanels,
+		Register:    RegisterOutdoorTemp,
+		RawValue:    0x64,
+		Value:       Temperature{Celsius: 0},
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"time":"2021-10-01T12:00:00Z","source":17,"destination":32,"register":50,"raw":100,"value":0,"register_name":"outdoor_temp","unit":"°C"}`
+	if string(b) != expected {
+		t.Errorf("expected %s got %s", expected, b)
+	}
+}
+
+func TestEncodeFrame(t *testing.T) {
+	frame := EncodeFrame(MsgDomain, 0x27, MsgMainboard1, 0, RegisterOutdoorTemp)
+	expected := [6]byte{0x01, 0x27, 0x11, 0x00, 0x32, 0x6b}
+	if frame != expected {
+		t.Errorf("expected %x got %x", expected, frame)
+	}
+	pkg := createQuery(&Vallox{remoteClientId: 0x27}, RegisterOutdoorTemp)
+	if pkg.Checksum != frame[5] {
+		t.Errorf("expected checksum %x got %x", frame[5], pkg.Checksum)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	packages := []*valloxPackage{
+		createQuery(v, RegisterOutdoorTemp),
+		createWrite(v, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed4),
+		createWrite(v, MsgMainboards, RegisterProgram, 0xff),
+	}
+	for _, pkg := range packages {
+		expected := EncodeFrame(pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value)
+		for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+			var buf bytes.Buffer
+			if err := binary.Write(&buf, order, pkg); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), expected[:]) {
+				t.Errorf("%v: expected frame %x got %x", order, expected, buf.Bytes())
+			}
+			decoded, ok := validPackage(buf.Bytes())
+			if !ok || decoded != *pkg {
+				t.Errorf("%v: frame %x decoded to %+v %v", order, buf.Bytes(), decoded, ok)
+			}
+		}
+
+		reversed := make([]byte, 6)
+		for i, b := range expected {
+			reversed[5-i] = b
+		}
+		if _, ok := validPackage(reversed); ok {
+			t.Errorf("reversed frame %x accepted", reversed)
+		}
+	}
+}
+
+func TestChecksumWraparound(t *testing.T) {
+	tests := []struct {
+		frame    [5]byte
+		checksum byte
+	}{
+		{[5]byte{0x01, 0x11, 0x20, 0x29, 0xff}, 0x5a},
+		{[5]byte{0x01, 0x2f, 0x11, 0xfe, 0xff}, 0x3e},
+		{[5]byte{0xff, 0xff, 0xff, 0xff, 0xff}, 0xfb},
+		{[5]byte{0x01, 0x00, 0x00, 0x00, 0xff}, 0x00},
+	}
+	for _, test := range tests {
+		f := test.frame
+		if c := Checksum(f[0], f[1], f[2], f[3], f[4]); c != test.checksum {
+			t.Errorf("expected checksum %x of %x got %x", test.checksum, f, c)
+		}
+		sum := 0
+		for _, b := range f {
+			sum += int(b)
+		}
+		if byte(sum%256) != test.checksum {
+			t.Errorf("checksum %x of %x is not the sum modulo 256", test.checksum, f)
+		}
+	}
+
+	frame := testFrame(MsgDomain, 0x2f, MsgMainboard1, RegisterProgram, 0xff)
+	if _, ok := validPackage(frame); !ok {
+		t.Errorf("frame %x with wrapped checksum rejected", frame)
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed4)
+	e, ok := DecodeFrame(frame)
+	if !ok {
+		t.Fatalf("valid frame %x not decoded", frame)
+	}
+	if e.Source != MsgMainboard1 || e.Destination != MsgPanels || e.Value != FanSpeed(4) || !bytes.Equal(e.RawFrame[:], frame) {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	frame[5]++
+	if _, ok := DecodeFrame(frame); ok {
+		t.Errorf("invalid checksum decoded")
+	}
+	if _, ok := DecodeFrame(frame[:5]); ok {
+		t.Errorf("short frame decoded")
+	}
+}
+
+func TestIncludeRawFrame(t *testing.T) {
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64)
+
+	v, _ := newVallox(nil, Config{})
+	feedBuffer(v, frame)
+	if e := <-v.in; e.RawFrame != ([6]byte{}) {
+		t.Errorf("raw frame set by default %x", e.RawFrame)
+	}
+
+	v, _ = newVallox(nil, Config{IncludeRawFrame: true})
+	feedBuffer(v, frame)
+	e := <-v.in
+	if !bytes.Equal(e.RawFrame[:], frame) {
+		t.Errorf("expected raw frame %x got %x", frame, e.RawFrame)
+	}
+	b, _ := json.Marshal(e)
+	if !strings.Contains(string(b), `"raw_frame":"`+hex.EncodeToString(frame)+`"`) {
+		t.Errorf("raw frame missing from %s", b)
+	}
+}
+
 func TestValueToSpeed(t *testing.T) {
 	assertSpeed(1, 1, t)
 	assertSpeed(3, 2, t)
@@ -33,6 +221,174 @@ func TestValueToSpeed(t *testing.T) {
 	assertSpeed(255, 8, t)
 }
 
+func TestValueToRH(t *testing.T) {
+	tests := map[byte]float64{0x00: 0, 0x33: 0, 0x99: 50, 0xff: 100, 0x80: 37.75}
+	for raw, expected := range tests {
+		if rh := decodeRh(raw); rh != expected {
+			t.Errorf("raw %x was not converted to %v%% but to %v%%", raw, expected, rh)
+		}
+	}
+	e := decodeEvent(&valloxPackage{Register: RegisterBasicHumidity, Value: 0x99}, nil)
+	if e.Value != 50.0 {
+		t.Errorf("expected basic humidity 50%% got %v", e.Value)
+	}
+}
+
+func TestExportedConversions(t *testing.T) {
+	if s := ValueToSpeed(0x05); s != -1 {
+		t.Errorf("unknown pattern converted to %d", s)
+	}
+	if v := SpeedToValue(9); v != 0 {
+		t.Errorf("out of range speed converted to %d", v)
+	}
+	if c := ValueToTemp(246); c != 97 {
+		t.Errorf("temp 246 was not converted to 97 but to %d", c)
+	}
+}
+
+func TestCustomDecoders(t *testing.T) {
+	decoders := map[byte]func(byte) interface{}{
+		Register8f:          func(value byte) interface{} { return value&0x01 != 0 },
+		RegisterOutdoorTemp: func(value byte) interface{} { return int(value) - 100 },
+	}
+	v, _ := newVallox(nil, Config{Decoders: decoders})
+	delete(decoders, Register8f)
+
+	if e := decodeEvent(&valloxPackage{Register: Register8f, Value: 0x03}, v); e.Value != true || e.RawValue != 0x03 {
+		t.Errorf("custom decoder not used %+v", e)
+	}
+	if e := decodeEvent(&valloxPackage{Register: RegisterOutdoorTemp, Value: 0x80}, v); e.Value != 28 {
+		t.Errorf("custom decoder did not override built-in %+v", e)
+	}
+	if e := decodeEvent(&valloxPackage{Register: Register91, Value: 0x03}, v); e.Value != int16(3) {
+		t.Errorf("register without decoder not decoded as plain value %+v", e)
+	}
+
+	// typed accessors do not guess the meaning of a custom decoded register
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80))
+	if temp, ok := v.OutdoorTemp(); ok {
+		t.Errorf("typed accessor of custom decoded register returned %d", temp)
+	}
+	if e, ok := v.Get(RegisterOutdoorTemp); !ok || e.Value != 28 || e.RawValue != 0x80 {
+		t.Errorf("unexpected cached event %+v %v", e, ok)
+	}
+	if _, ok := v.SupplyTemp(); !ok {
+		t.Errorf("typed accessor of built-in decoded register not ok")
+	}
+}
+
+func TestTempRoundTrip(t *testing.T) {
+	// every raw value decodes to a temperature encoding back to the same one
+	for raw := 0; raw < int(TempSensorFault); raw++ {
+		celsius := valueToTemp(byte(raw))
+		value, err := tempToValue(int(celsius))
+		if err != nil {
+			t.Errorf("temp %d of raw %x rejected: %v", celsius, raw, err)
+		} else if c := valueToTemp(value); c != celsius {
+			t.Errorf("raw %x decoded to %d encoded to %x decoded to %d", raw, celsius, value, c)
+		}
+	}
+	// every temperature in range encodes within half a step of the table
+	for celsius := -74; celsius <= 97; celsius++ {
+		value, _ := tempToValue(celsius)
+		diff := abs(int(valueToTemp(value)) - celsius)
+		step := 1
+		if value > 0 && int(tempConversion[value]-tempConversion[value-1]) > step {
+			step = int(tempConversion[value] - tempConversion[value-1])
+		}
+		if value < TempSensorFault-1 && int(tempConversion[value+1]-tempConversion[value]) > step {
+			step = int(tempConversion[value+1] - tempConversion[value])
+		}
+		if diff*2 > step {
+			t.Errorf("temp %d encoded to %x decoding %d off with step %d", celsius, value, diff, step)
+		}
+	}
+}
+
+func TestRHRoundTrip(t *testing.T) {
+	for raw := RHOffset; raw <= 0xff; raw++ {
+		value, err := rhToValue(decodeRh(byte(raw)))
+		if err != nil || value != byte(raw) {
+			t.Errorf("raw %x decoded to %v%% encoded to %x err %v", raw, decodeRh(byte(raw)), value, err)
+		}
+	}
+	// decoding clamps values below the offset to 0%
+	if value, _ := rhToValue(decodeRh(0x00)); value != RHOffset {
+		t.Errorf("0%% encoded to %x", value)
+	}
+
+	withinHalfStep := func(percent uint16) bool {
+		rh := float64(percent%10001) / 100
+		value, err := rhToValue(rh)
+		return err == nil && math.Abs(valueToRh(value)-rh) <= 0.5/RHDivider+1e-9
+	}
+	if err := quick.Check(withinHalfStep, nil); err != nil {
+		t.Error(err)
+	}
+	for _, rh := range []float64{-1, 100.1, math.NaN()} {
+		if value, err := rhToValue(rh); err == nil {
+			t.Errorf("humidity %v accepted as %x", rh, value)
+		}
+	}
+}
+
+func TestSpeedRoundTrip(t *testing.T) {
+	for raw := 0; raw <= 0xff; raw++ {
+		speed, ok := FanSpeedFromRaw(byte(raw))
+		if ok && speed.RawPattern() != byte(raw) {
+			t.Errorf("raw %x decoded to %d encoded to %x", raw, speed, speed.RawPattern())
+		}
+		if ok != (valueToSpeed(byte(raw)) > 0) {
+			t.Errorf("raw %x decoded inconsistently", raw)
+		}
+	}
+	for speed := int8(1); speed <= 8; speed++ {
+		if s := valueToSpeed(speedToValue(speed)); s != speed {
+			t.Errorf("speed %d encoded and decoded to %d", speed, s)
+		}
+	}
+}
+
+func TestDecodeFanSpeed(t *testing.T) {
+	if s := decodeFanSpeed(FanSpeed3); s != 3 || !s.IsValid() {
+		t.Errorf("raw %d was not decoded to valid speed 3 but to %d", FanSpeed3, s)
+	}
+	if s := decodeFanSpeed(0x05); s != 0 || s.IsValid() {
+		t.Errorf("unknown pattern 0x05 was not decoded to invalid speed but to %d", s)
+	}
+}
+
+func TestDecodeMaxFanSpeed(t *testing.T) {
+	for raw, expected := range map[byte]FanSpeed{FanSpeed1: 1, FanSpeed5: 5, FanSpeed8: 8, 0x05: 3, 0x10: 5, 0x00: 0} {
+		if s := decodeMaxFanSpeed(raw); s != expected {
+			t.Errorf("max fan speed %x was not decoded to %d but to %d", raw, expected, s)
+		}
+	}
+	e := decodeEvent(&valloxPackage{Register: RegisterMaxFanSpeed, Value: 0x0d}, nil)
+	if e.Value != FanSpeed(4) {
+		t.Errorf("partial pattern 0x0d decoded to %v", e.Value)
+	}
+}
+
+func TestFanSpeedRawPattern(t *testing.T) {
+	for speed := FanSpeed(1); speed <= 8; speed++ {
+		raw := speed.RawPattern()
+		if s, ok := FanSpeedFromRaw(raw); !ok || s != speed {
+			t.Errorf("speed %d raw %x converted back to %d %v", speed, raw, s, ok)
+		}
+	}
+	if raw := FanSpeed(9).RawPattern(); raw != 0 {
+		t.Errorf("invalid speed 9 converted to raw %x", raw)
+	}
+	if s, ok := FanSpeedFromRaw(0x05); ok {
+		t.Errorf("unknown pattern 0x05 converted to speed %d", s)
+	}
+	if s := intToFanSpeed(264); s.IsValid() {
+		t.Errorf("out of range 264 converted to valid speed %d", s)
+	}
+}
+
 func assertBoolean(expected bool, value bool, t *testing.T) {
 	if expected != value {
 		t.Errorf("exptected %v got %v", expected, value)
@@ -54,3 +410,1108 @@ func assertSpeed(raw byte, value int8, t *testing.T) {
 		t.Errorf("speed %d to raw was not converted to %d but to %d", value, raw, c)
 	}
 }
+
+func TestStartStop(t *testing.T) {
+	port := newFakePort()
+	v, err := newVallox(port, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.start()
+	assertBoolean(true, v.Running(), t)
+
+	port.feed(testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed2))
+	select {
+	case e := <-v.Events():
+		if e.Value != FanSpeed(2) {
+			t.Errorf("expected speed 2 got %v", e.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+
+	if err := v.Close(); err != nil {
+		t.Errorf("close failed: %v", err)
+	}
+	assertBoolean(false, v.Running(), t)
+	// Must not block after the bus is stopped
+	v.Query(RegisterSupplyTemp)
+	if err := v.Close(); err != nil {
+		t.Errorf("second close failed: %v", err)
+	}
+}
+
+func TestCanWrite(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	assertBoolean(false, v.WriteEnabled(), t)
+	assertBoolean(false, v.CanWrite(RegisterCurrentFanSpeed), t)
+
+	v, _ = newVallox(nil, Config{EnableWrite: true})
+	assertBoolean(true, v.WriteEnabled(), t)
+	assertBoolean(true, v.CanWrite(RegisterCurrentFanSpeed), t)
+	assertBoolean(false, v.CanWrite(RegisterStatus), t)
+	assertBoolean(false, v.CanWrite(0), t)
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterStatus}})
+	assertBoolean(true, v.CanWrite(RegisterStatus), t)
+	assertBoolean(false, v.CanWrite(RegisterCurrentFanSpeed), t)
+}
+
+func TestStartSmallOutQueue(t *testing.T) {
+	port := newFakePort()
+	v, err := newVallox(port, Config{OutQueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	// every frame waits for a quiet bus, so sending the init queries takes
+	// seconds with a queue this small
+	started := make(chan error)
+	go func() { started <- v.start() }()
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(busQuietTime):
+		t.Fatal("start blocked on a full out queue")
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	v, _ := newVallox(timeoutPort{}, Config{ReadTimeout: time.Millisecond})
+	v.startBus()
+	time.Sleep(10 * time.Millisecond)
+	assertBoolean(true, v.Running(), t)
+
+	v.Close()
+	select {
+	case _, ok := <-v.Events():
+		if ok {
+			t.Errorf("unexpected event")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reader did not stop after close")
+	}
+}
+
+func TestSerialConfig(t *testing.T) {
+	portCfg, err := serialConfig(Config{Device: "/dev/ttyUSB0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if portCfg.Baud != 9600 || portCfg.Size != 8 || portCfg.Parity != 'N' || portCfg.StopBits != 1 {
+		t.Errorf("expected 9600 8N1 by default got %+v", portCfg)
+	}
+
+	portCfg, err = serialConfig(Config{ByteSize: 7, Parity: 'E', StopBits: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if portCfg.Size != 7 || portCfg.Parity != 'E' || portCfg.StopBits != 2 {
+		t.Errorf("expected 7E2 got %+v", portCfg)
+	}
+
+	for _, cfg := range []Config{{ByteSize: 9}, {Parity: 'M'}, {StopBits: 3}} {
+		if _, err := serialConfig(cfg); err == nil {
+			t.Errorf("invalid framing accepted %+v", cfg)
+		}
+	}
+}
+
+// timeoutPort times out every read like a serial port with a read timeout
+type timeoutPort struct{}
+
+func (timeoutPort) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return 0, io.EOF
+}
+
+func (timeoutPort) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (timeoutPort) Close() error {
+	return nil
+}
+
+func TestInvalidDomainDropped(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	feedBuffer(v, testFrame(0x02, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80))
+	if len(v.in) != 0 {
+		t.Errorf("frame with invalid domain produced an event")
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80))
+	if len(v.in) != 1 {
+		t.Errorf("expected 1 event got %d", len(v.in))
+	}
+}
+
+func TestDropEcho(t *testing.T) {
+	v, _ := newVallox(nil, Config{DropEcho: true})
+	feedBuffer(v, testFrame(MsgDomain, v.remoteClientId, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed2))
+	if len(v.in) != 0 {
+		t.Errorf("echo of own frame produced an event")
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgPanel1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed2))
+	if len(v.in) != 1 {
+		t.Errorf("expected 1 event got %d", len(v.in))
+	}
+}
+
+func TestBufferBounded(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	done := make(chan struct{})
+	go func() {
+		for range v.in {
+		}
+		close(done)
+	}()
+
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80)
+	batch := bytes.Repeat(frame, 1000)
+	for i := 0; i < 1000; i++ {
+		// split frames across writes like a serial port does
+		feedBuffer(v, batch[:len(batch)-3])
+		feedBuffer(v, batch[len(batch)-3:])
+		if c := v.rawBuffer.Cap(); c > 64*1024 {
+			t.Fatalf("buffer capacity grew to %d after %d frames", c, (i+1)*1000)
+		}
+	}
+	close(v.in)
+	<-done
+}
+
+func TestFullQueueDrops(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80)
+	feedBuffer(v, bytes.Repeat(frame, cap(v.in)+5))
+	if len(v.in) != cap(v.in) {
+		t.Errorf("expected full queue got %d events", len(v.in))
+	}
+	if d := v.DroppedEvents(); d != 5 {
+		t.Errorf("expected 5 dropped events got %d", d)
+	}
+}
+
+func TestOnEvent(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	received := make(chan FanSpeed, 2)
+	for i := 0; i < 2; i++ {
+		v.OnEvent(func(e Event) {
+			received <- e.Value.(FanSpeed)
+		})
+	}
+	go dispatchEvents(v)
+	defer close(v.done)
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed4))
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-received:
+			if s != 4 {
+				t.Errorf("handler received speed %d", s)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for handler")
+		}
+	}
+	if len(v.in) != 1 {
+		t.Errorf("event was not delivered to Events channel")
+	}
+}
+
+func TestSetRemoteClientId(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	for _, id := range []byte{0x30, MsgPanels, 0x1f} {
+		if err := v.SetRemoteClientId(id); err == nil {
+			t.Errorf("invalid id %x accepted", id)
+		}
+		if _, err := newVallox(nil, Config{RemoteClientId: id}); err == nil {
+			t.Errorf("invalid configured id %x accepted", id)
+		}
+	}
+	if err := v.SetRemoteClientId(0x25); err != nil {
+		t.Fatal(err)
+	}
+	if pkg := createQuery(v, RegisterOutdoorTemp); pkg.Source != 0x25 {
+		t.Errorf("expected source 25 got %x", pkg.Source)
+	}
+	assertBoolean(true, v.ForMe(Event{Destination: 0x25}), t)
+	assertBoolean(false, v.ForMe(Event{Destination: 0x27}), t)
+}
+
+func TestSetSpeed(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	if err := v.SetSpeed(3); err != ErrWriteDisabled {
+		t.Errorf("expected ErrWriteDisabled got %v", err)
+	}
+	v.writeAllowed = true
+	if err := v.SetSpeed(9); err == nil {
+		t.Errorf("invalid speed accepted")
+	}
+	if err := v.SetDefaultFanSpeed(0); err == nil {
+		t.Errorf("invalid speed accepted")
+	}
+	if err := v.SetMaxFanSpeed(5); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterMaxFanSpeed, FanSpeed5, t)
+	assertWrite(v, MsgPanels, RegisterMaxFanSpeed, FanSpeed5, t)
+}
+
+func TestWriteRegisterTo(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	if err := v.WriteRegisterTo(0x21, RegisterCurrentFanSpeed, FanSpeed2); err != ErrWriteDisabled {
+		t.Errorf("expected ErrWriteDisabled got %v", err)
+	}
+	v.writeAllowed = true
+	for _, destination := range []byte{0x30, MsgMainboards, MsgPanels} {
+		if err := v.WriteRegisterTo(destination, RegisterCurrentFanSpeed, FanSpeed2); err == nil {
+			t.Errorf("invalid destination %x accepted", destination)
+		}
+		if err := v.SetSpeedFor(destination, 2); err == nil {
+			t.Errorf("invalid destination %x accepted", destination)
+		}
+		if err := v.WriteRegisterContext(context.Background(), destination, RegisterCurrentFanSpeed, FanSpeed2); err == nil {
+			t.Errorf("invalid destination %x accepted", destination)
+		}
+	}
+	if len(v.out) != 0 {
+		t.Errorf("write to invalid destination queued")
+	}
+	if err := v.SetSpeedFor(0x22, 9); err == nil {
+		t.Errorf("invalid speed accepted")
+	}
+	if err := v.SetSpeedFor(0x22, 2); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, 0x22, RegisterCurrentFanSpeed, FanSpeed2, t)
+	if len(v.out) != 0 {
+		t.Errorf("expected a single write")
+	}
+
+	if err := v.WriteRegister(RegisterProgram, 0x08); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram, 0x08, t)
+	assertWrite(v, MsgPanels, RegisterProgram, 0x08, t)
+}
+
+func TestWriteNotQueuedWhenNotAllowed(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	if err := v.SetSpeed(3); err != ErrWriteDisabled {
+		t.Errorf("expected ErrWriteDisabled got %v", err)
+	}
+	if err := v.WriteRegisterTo(MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed3); err != ErrWriteDisabled {
+		t.Errorf("expected ErrWriteDisabled got %v", err)
+	}
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterProgram}})
+	if err := v.SetSpeed(3); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+	if err := v.WriteRegister(RegisterStatus, 0x01); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+	if err := v.WriteRegisterTo(MsgMainboard1, RegisterStatus, 0x01); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+	if len(v.out) != 0 {
+		t.Errorf("expected nothing queued got %d frames", len(v.out))
+	}
+}
+
+func TestSetTemps(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	assertBoolean(false, isOutgoingAllowed(v, RegisterPreheatingTemp), t)
+	assertBoolean(false, isOutgoingAllowed(v, RegisterSupplyFanStopTemp), t)
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterPreheatingTemp, RegisterSupplyFanStopTemp}})
+	if err := v.SetPreheatingTemp(-100); err == nil {
+		t.Errorf("invalid temperature accepted")
+	}
+	if err := v.SetPreheatingTemp(-5); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := tempToValue(-5)
+	assertWrite(v, MsgMainboard1, RegisterPreheatingTemp, value, t)
+	assertWrite(v, MsgPanels, RegisterPreheatingTemp, value, t)
+
+	if err := v.SetSupplyFanStopTemp(-12); err != nil {
+		t.Fatal(err)
+	}
+	pkg := <-v.out
+	if e := decodeEvent(&pkg.valloxPackage, v); e.Register != RegisterSupplyFanStopTemp || e.Value != (Temperature{Celsius: -12}) {
+		t.Errorf("unexpected write %+v", e)
+	}
+}
+
+func TestSetFanSetpoints(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	assertBoolean(false, isOutgoingAllowed(v, RegisterSupplyFanSetpoint), t)
+	assertBoolean(false, isOutgoingAllowed(v, RegisterExhaustFanSetpoint), t)
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterSupplyFanSetpoint, RegisterExhaustFanSetpoint}})
+	if err := v.SetSupplyFanSetpoint(101); err == nil {
+		t.Errorf("invalid percent accepted")
+	}
+	if err := v.SetExhaustFanSetpoint(80); err != nil {
+		t.Fatal(err)
+	}
+	pkg := <-v.out
+	if e := decodeEvent(&pkg.valloxPackage, v); e.Destination != MsgMainboard1 || e.Register != RegisterExhaustFanSetpoint || e.Value != 80.0 {
+		t.Errorf("unexpected write %+v", e)
+	}
+	if len(v.out) != 0 {
+		t.Errorf("setpoint written to panels")
+	}
+}
+
+func TestSetAntiFreezeHysteresis(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	if err := v.SetAntiFreezeHysteresis(3); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterAntiFreezeHysteresis}})
+	for _, value := range []byte{0, 11} {
+		if err := v.SetAntiFreezeHysteresis(value); err == nil {
+			t.Errorf("invalid hysteresis %d accepted", value)
+		}
+	}
+	if err := v.SetAntiFreezeHysteresis(3); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterAntiFreezeHysteresis, 3, t)
+	assertWrite(v, MsgPanels, RegisterAntiFreezeHysteresis, 3, t)
+}
+
+func TestSetServiceInterval(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	assertBoolean(false, isOutgoingAllowed(v, RegisterServiceInterval), t)
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterServiceInterval}})
+	for _, months := range []byte{0, 13} {
+		if err := v.SetServiceInterval(months); err == nil {
+			t.Errorf("invalid interval %d accepted", months)
+		}
+	}
+	if err := v.SetServiceInterval(6); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterServiceInterval, 6, t)
+	assertWrite(v, MsgPanels, RegisterServiceInterval, 6, t)
+	assertBoolean(true, isOutgoingAllowed(v, RegisterServiceInterval), t)
+}
+
+func TestResetCounters(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	if err := v.ResetServiceCounter(); err != ErrWriteDisabled {
+		t.Errorf("expected ErrWriteDisabled got %v", err)
+	}
+	v.writeAllowed = true
+	if err := v.ResetFireplaceCounter(); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterFireplaceCounter, RegisterServiceCounter}})
+	if err := v.ResetFireplaceCounter(); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterFireplaceCounter, 0, t)
+	assertWrite(v, MsgPanels, RegisterFireplaceCounter, 0, t)
+	if err := v.ResetServiceCounter(); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterServiceCounter, 0, t)
+}
+
+func TestSpeedPercent(t *testing.T) {
+	for speed := 1; speed <= 8; speed++ {
+		if s := PercentToSpeed(SpeedToPercent(speed)); int(s) != speed {
+			t.Errorf("speed %d converted to %d%% and back to %d", speed, SpeedToPercent(speed), s)
+		}
+	}
+	if p := SpeedToPercent(4); p != 50 {
+		t.Errorf("expected 50%% got %d", p)
+	}
+	if s := PercentToSpeed(0); s != 1 {
+		t.Errorf("expected speed 1 got %d", s)
+	}
+	if s := PercentToSpeed(70); s != 6 {
+		t.Errorf("expected speed 6 got %d", s)
+	}
+
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	if err := v.SetSpeedPercent(101); err == nil {
+		t.Errorf("invalid percent accepted")
+	}
+	updateCache(v, &Event{Register: RegisterMaxFanSpeed, RawValue: FanSpeed5})
+	if err := v.SetSpeedPercent(100); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed5, t)
+}
+
+func TestQueryAll(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	defer close(v.done)
+	v.out = make(chan outgoing, 2)
+
+	registers := []byte{RegisterOutdoorTemp, RegisterSupplyTemp, RegisterRH1, RegisterRH2}
+	v.QueryAll(registers...)
+	for _, register := range registers {
+		select {
+		case pkg := <-v.out:
+			if pkg.Register != 0 || pkg.Value != register {
+				t.Errorf("expected query of %x got %x = %x", register, pkg.Register, pkg.Value)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for query of %x", register)
+		}
+	}
+}
+
+func TestQueryAllOverflow(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	v.out = make(chan outgoing, 1)
+
+	v.QueryAll(RegisterOutdoorTemp, RegisterSupplyTemp, RegisterRH1)
+	// a stalled bus, e.g. a poll every tick, does not pile up queries
+	for i := 0; i < 100; i++ {
+		v.QueryAll(RegisterSupplyTemp, RegisterRH1, RegisterRH2)
+	}
+	v.mu.Lock()
+	waiting := len(v.overflow)
+	v.mu.Unlock()
+	if waiting != 3 {
+		t.Errorf("expected 3 waiting queries got %d", waiting)
+	}
+	if pending := atomic.LoadInt32(&v.pending); pending != 4 {
+		t.Errorf("expected 4 pending got %d", pending)
+	}
+
+	for _, register := range []byte{RegisterOutdoorTemp, RegisterSupplyTemp, RegisterRH1, RegisterRH2} {
+		select {
+		case pkg := <-v.out:
+			if pkg.Register != 0 || pkg.Value != register {
+				t.Errorf("expected query of %x got %x = %x", register, pkg.Register, pkg.Value)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for query of %x", register)
+		}
+	}
+
+	waitOverflow(v, t)
+
+	// the background sender stops on close. Nothing decrements the pending
+	// count of the queries read above.
+	before := atomic.LoadInt32(&v.pending)
+	v.QueryAll(RegisterOutdoorTemp, RegisterSupplyTemp, RegisterRH1)
+	close(v.done)
+	waitOverflow(v, t)
+	if pending := atomic.LoadInt32(&v.pending) - before; pending != 1 {
+		t.Errorf("expected only the queued query pending got %d", pending)
+	}
+}
+
+// waitOverflow waits until no queries are waiting to be queued in the background
+func waitOverflow(v *Vallox, t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		v.mu.Lock()
+		waiting := len(v.overflow)
+		v.mu.Unlock()
+		if waiting == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d queries still waiting", waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSetSpeedAndVerify(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	replied := make(chan struct{})
+	reply := func(value byte) {
+		// answer once the query has been queued
+		for len(v.out) < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		for len(v.out) > 0 {
+			<-v.out
+		}
+		feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, v.remoteClientId, RegisterCurrentFanSpeed, value))
+		replied <- struct{}{}
+	}
+
+	go reply(FanSpeed4)
+	if err := v.SetSpeedAndVerify(4, time.Second); err != nil {
+		t.Errorf("verify failed: %v", err)
+	}
+	<-replied
+
+	go reply(FanSpeed2)
+	if err := v.SetSpeedAndVerify(4, time.Second); err == nil {
+		t.Errorf("mismatching speed verified")
+	}
+	<-replied
+	for len(v.out) > 0 {
+		<-v.out
+	}
+
+	if err := v.SetSpeedAndVerify(4, 10*time.Millisecond); err == nil {
+		t.Errorf("verified without answer")
+	}
+}
+
+func TestSetProgramFlag(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	if err := v.SetProgramFlag(ProgramFlagBoostSwitch, true); err == nil {
+		t.Errorf("program flag set without known program value")
+	}
+	if err := v.SetProgramFlag(0x01, true); err == nil {
+		t.Errorf("invalid program flag accepted")
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterProgram, ProgramFlagWater|0x0a))
+	if err := v.SetProgramFlag(ProgramFlagBoostSwitch, true); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram, ProgramFlagWater|ProgramFlagBoostSwitch|0x0a, t)
+	assertWrite(v, MsgPanels, RegisterProgram, ProgramFlagWater|ProgramFlagBoostSwitch|0x0a, t)
+
+	if err := v.SetProgramFlag(ProgramFlagWater, false); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram, ProgramFlagBoostSwitch|0x0a, t)
+}
+
+func TestSetProgramFlagsInARow(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterProgram, 0x0a))
+
+	// the second change is based on the first one, not on the cached value
+	if err := v.SetProgramFlag(ProgramFlagWater, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SetProgramFlag(ProgramFlagCascadeControl, true); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram, ProgramFlagWater|0x0a, t)
+	assertWrite(v, MsgPanels, RegisterProgram, ProgramFlagWater|0x0a, t)
+	assertWrite(v, MsgMainboard1, RegisterProgram, ProgramFlagWater|ProgramFlagCascadeControl|0x0a, t)
+	assertWrite(v, MsgPanels, RegisterProgram, ProgramFlagWater|ProgramFlagCascadeControl|0x0a, t)
+
+	// a panel repeating the old value does not replace the written one
+	feedBuffer(v, testFrame(MsgDomain, 0x21, MsgMainboards, RegisterProgram, 0x0a))
+	if err := v.SetProgram(ProgramFlags{Water: true, CascadeControl: true, AutomaticHumidity: true}); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram, ProgramFlagWater|ProgramFlagCascadeControl|ProgramFlagAutomaticHumidity|0x0a, t)
+	<-v.out
+
+	// the value reported by the mainboard is used again
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterProgram, 0x0a))
+	if err := v.SetProgramFlag(ProgramFlagWater, true); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram, ProgramFlagWater|0x0a, t)
+}
+
+func TestSetProgram(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	if err := v.SetProgram(ProgramFlags{Water: true}); err == nil {
+		t.Errorf("program set without known program value")
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterProgram, ProgramFlagWater|ProgramFlagCascadeControl|0x0a))
+	e, _ := v.Get(RegisterProgram)
+	flags := e.Value.(ProgramFlags)
+	flags.CascadeControl = false
+	flags.AutomaticHumidity = true
+	if err := v.SetProgram(flags); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram, ProgramFlagWater|ProgramFlagAutomaticHumidity|0x0a, t)
+	assertWrite(v, MsgPanels, RegisterProgram, ProgramFlagWater|ProgramFlagAutomaticHumidity|0x0a, t)
+
+	v, _ = newVallox(nil, Config{})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterProgram, 0))
+	if err := v.SetProgram(ProgramFlags{}); err != ErrWriteDisabled {
+		t.Errorf("expected ErrWriteDisabled got %v", err)
+	}
+}
+
+func TestSetMaximumSpeedLimit(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterProgram2, 0))
+	if err := v.SetMaximumSpeedLimit(true); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+
+	v, _ = newVallox(nil, Config{EnableWrite: true, WritableRegisters: []byte{RegisterProgram2}})
+	if _, ok := v.MaximumSpeedLimitEnabled(); ok {
+		t.Errorf("maximum speed limit known before program2 was received")
+	}
+	if err := v.SetMaximumSpeedLimit(true); err == nil {
+		t.Errorf("maximum speed limit set without known program2 value")
+	}
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterProgram2, 0xf0))
+	if on, ok := v.MaximumSpeedLimitEnabled(); on || !ok {
+		t.Errorf("expected maximum speed limit off got %v %v", on, ok)
+	}
+	if err := v.SetMaximumSpeedLimit(true); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram2, 0xf0|Program2FlagMaximumSpeedLimit, t)
+	assertWrite(v, MsgPanels, RegisterProgram2, 0xf0|Program2FlagMaximumSpeedLimit, t)
+
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterProgram2, 0xf0|Program2FlagMaximumSpeedLimit))
+	if on, ok := v.MaximumSpeedLimitEnabled(); !on || !ok {
+		t.Errorf("expected maximum speed limit on got %v %v", on, ok)
+	}
+	if err := v.SetMaximumSpeedLimit(false); err != nil {
+		t.Fatal(err)
+	}
+	assertWrite(v, MsgMainboard1, RegisterProgram2, 0xf0, t)
+	assertWrite(v, MsgPanels, RegisterProgram2, 0xf0, t)
+}
+
+func assertWrite(v *Vallox, destination byte, register byte, value byte, t *testing.T) {
+	t.Helper()
+	select {
+	case pkg := <-v.out:
+		if pkg.Destination != destination || pkg.Register != register || pkg.Value != value {
+			t.Errorf("expected write %x %x = %x got %x %x = %x",
+				destination, register, value, pkg.Destination, pkg.Register, pkg.Value)
+		}
+	default:
+		t.Errorf("expected write %x %x = %x, nothing queued", destination, register, value)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{EnableWrite: true, DryRun: true})
+	updateLastActivity(v)
+	atomic.StoreInt32(&v.running, 1)
+	go handleOutgoing(v)
+	defer v.Close()
+
+	if err := v.SetSpeed(2); err != nil {
+		t.Fatal(err)
+	}
+	v.Query(RegisterOutdoorTemp)
+
+	query := createQuery(v, RegisterOutdoorTemp)
+	expected := []byte{query.System, query.Source, query.Destination, query.Register, query.Value, query.Checksum}
+	deadline := time.Now().Add(time.Second)
+	for v.Metrics().FramesSent == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	port.mu.Lock()
+	defer port.mu.Unlock()
+	if !bytes.Equal(port.written.Bytes(), expected) {
+		t.Errorf("expected only query %x written got %x", expected, port.written.Bytes())
+	}
+}
+
+func TestWaitQuietBus(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	updateLastActivity(v)
+	stopTraffic := time.After(80 * time.Millisecond)
+	go func() {
+		// keep the bus busy for a while
+		for {
+			select {
+			case <-stopTraffic:
+				return
+			case <-time.After(10 * time.Millisecond):
+				updateLastActivity(v)
+			}
+		}
+	}()
+
+	waitQuietBus(v, context.Background(), createQuery(v, RegisterSupplyTemp))
+	if quiet := time.Since(getLastActivity(v)); quiet < busQuietTime {
+		t.Errorf("transmit allowed after only %v of quiet", quiet)
+	}
+}
+
+func TestWaitQuietBusClock(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	clock := newFakeClock(v)
+	pkg := createQuery(v, RegisterSupplyTemp)
+	// a done context makes any wait fail instead of sleeping
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	updateLastActivity(v)
+	clock.Advance(busQuietTime - time.Millisecond)
+	if err := waitQuietBus(v, ctx, pkg); err != context.Canceled {
+		t.Errorf("expected wait before quiet time got %v", err)
+	}
+	clock.Advance(time.Millisecond)
+	if err := waitQuietBus(v, ctx, pkg); err != nil {
+		t.Errorf("expected no wait after quiet time got %v", err)
+	}
+}
+
+func TestEventTimeClock(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	clock := newFakeClock(v)
+	pkg := valloxPackage{MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80, 0}
+	if e := decodeEvent(&pkg, v); !e.Time.Equal(clock.Now()) {
+		t.Errorf("expected event time %v got %v", clock.Now(), e.Time)
+	}
+}
+
+func TestWriteRegisterContext(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{EnableWrite: true})
+	atomic.StoreInt32(&v.running, 1)
+	go handleOutgoing(v)
+	defer v.Close()
+
+	if err := v.WriteRegisterContext(context.Background(), MsgMainboard1, RegisterStatus, 1); err != ErrRegisterNotWritable {
+		t.Errorf("expected ErrRegisterNotWritable got %v", err)
+	}
+	if err := v.WriteRegisterContext(context.Background(), MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed3); err != nil {
+		t.Fatal(err)
+	}
+	pkg := createWrite(v, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed3)
+	expected := []byte{pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value, pkg.Checksum}
+	port.mu.Lock()
+	written := port.written.Bytes()
+	port.mu.Unlock()
+	if !bytes.Equal(written, expected) {
+		t.Errorf("expected %x written got %x", expected, written)
+	}
+
+	// traffic keeps the bus busy beyond the deadline
+	stopTraffic := make(chan struct{})
+	defer close(stopTraffic)
+	go func() {
+		for {
+			select {
+			case <-stopTraffic:
+				return
+			case <-time.After(10 * time.Millisecond):
+				updateLastActivity(v)
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := v.WriteRegisterContext(ctx, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed4); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded waiting for quiet bus got %v", err)
+	}
+}
+
+func TestWriteRegisterContextBacklog(t *testing.T) {
+	port := newFakePort()
+	v, _ := newVallox(port, Config{EnableWrite: true})
+	atomic.StoreInt32(&v.running, 1)
+	go handleOutgoing(v)
+	defer v.Close()
+
+	// each query waits for a quiet bus, the backlog outlasts the deadline
+	for i := 0; i < 4; i++ {
+		v.enqueue(createQuery(v, RegisterSupplyTemp))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := v.WriteRegisterContext(ctx, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed4); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded while queued got %v", err)
+	}
+	if pending := atomic.LoadInt32(&v.pending); pending < 2 {
+		t.Errorf("expected the backlog still queued got %d pending", pending)
+	}
+
+	if err := v.Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	pkg := createWrite(v, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed4)
+	port.mu.Lock()
+	written := port.written.Bytes()
+	port.mu.Unlock()
+	if bytes.Contains(written, []byte{pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value, pkg.Checksum}) {
+		t.Errorf("write sent after its deadline")
+	}
+	if len(written) != 4*6 {
+		t.Errorf("expected the 4 queries written got %x", written)
+	}
+}
+
+func TestWriteRegisterContextQueueFull(t *testing.T) {
+	v, _ := newVallox(nil, Config{EnableWrite: true})
+	defer close(v.done)
+	v.out = make(chan outgoing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := v.WriteRegisterContext(ctx, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed3); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded while queued got %v", err)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	v.Pause()
+	assertBoolean(true, v.Paused(), t)
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80))
+	if len(v.in) != 0 {
+		t.Errorf("event delivered while paused")
+	}
+	if e, ok := v.Get(RegisterOutdoorTemp); !ok || e.RawValue != 0x80 {
+		t.Errorf("cache not updated while paused")
+	}
+
+	v.Resume()
+	assertBoolean(false, v.Paused(), t)
+	if len(v.in) != 0 {
+		t.Errorf("event received while paused delivered after resume")
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x81))
+	if len(v.in) != 1 {
+		t.Errorf("event not delivered after resume")
+	}
+}
+
+func TestEventSeq(t *testing.T) {
+	v, _ := newVallox(nil, Config{OnlyForMe: true})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x80))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, 0x21, RegisterOutdoorTemp, 0x81))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x82))
+
+	first, second := <-v.in, <-v.in
+	if first.Seq != 1 || second.Seq != 3 {
+		t.Errorf("expected sequence numbers 1 and 3 with a gap got %d and %d", first.Seq, second.Seq)
+	}
+	if e, _ := v.Get(RegisterOutdoorTemp); e.Seq != 2 {
+		t.Errorf("expected the filtered event numbered 2 got %d", e.Seq)
+	}
+	if b, _ := json.Marshal(first); !strings.Contains(string(b), `"seq":1`) {
+		t.Errorf("sequence number missing from %s", b)
+	}
+}
+
+func TestPromiscuous(t *testing.T) {
+	v, _ := newVallox(nil, Config{DropEcho: true, Promiscuous: true})
+	feedBuffer(v, testFrame(MsgDomain, v.remoteClientId, MsgMainboard1, RegisterCurrentFanSpeed, FanSpeed2))
+	if len(v.in) != 1 {
+		t.Errorf("promiscuous mode did not deliver own frame")
+	}
+}
+
+func TestStrictAddressing(t *testing.T) {
+	frame := testFrame(MsgDomain, 0x42, MsgPanels, RegisterSupplyTemp, 0x80)
+	v, _ := newVallox(nil, Config{})
+	feedBuffer(v, frame)
+	if len(v.in) != 1 {
+		t.Errorf("odd address rejected without strict addressing")
+	}
+
+	v, _ = newVallox(nil, Config{StrictAddressing: true})
+	feedBuffer(v, frame)
+	if len(v.in) != 0 {
+		t.Errorf("frame from invalid source accepted")
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, 0x05, RegisterSupplyTemp, 0x80))
+	if len(v.in) != 0 {
+		t.Errorf("frame to invalid destination accepted")
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanel1, RegisterSupplyTemp, 0x80))
+	if len(v.in) != 1 {
+		t.Errorf("valid frame rejected")
+	}
+}
+
+func TestBroadcastAndDirected(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	broadcast := Event{Destination: MsgPanels}
+	directed := Event{Destination: v.RemoteClientId()}
+	other := Event{Destination: 0x21}
+
+	assertBoolean(true, broadcast.Broadcast(), t)
+	assertBoolean(true, Event{Destination: MsgMainboards}.Broadcast(), t)
+	assertBoolean(false, directed.Broadcast(), t)
+	assertBoolean(false, v.DirectedToMe(broadcast), t)
+	assertBoolean(true, v.DirectedToMe(directed), t)
+	assertBoolean(false, v.DirectedToMe(other), t)
+	assertBoolean(true, v.ForMe(broadcast), t)
+	assertBoolean(true, v.ForMe(directed), t)
+	assertBoolean(false, v.ForMe(other), t)
+}
+
+func TestOnlyForMe(t *testing.T) {
+	v, _ := newVallox(nil, Config{OnlyForMe: true})
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanel1, RegisterSupplyTemp, 0x80))
+	if len(v.in) != 0 {
+		t.Errorf("event for another panel delivered")
+	}
+	if _, ok := v.Get(RegisterSupplyTemp); !ok {
+		t.Errorf("event for another panel not cached")
+	}
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterSupplyTemp, 0x80))
+	feedBuffer(v, testFrame(MsgDomain, MsgMainboard1, v.remoteClientId, RegisterSupplyTemp, 0x80))
+	if len(v.in) != 2 {
+		t.Errorf("expected 2 events got %d", len(v.in))
+	}
+}
+
+func BenchmarkHandleBuffer(b *testing.B) {
+	v, _ := newVallox(nil, Config{})
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		feedBuffer(v, frame)
+		<-v.in
+	}
+}
+
+func TestHandlePackageAllocs(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	pkg := valloxPackage{MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed3, 0}
+	allocs := testing.AllocsPerRun(100, func() {
+		handlePackage(&pkg, v)
+		<-v.in
+	})
+	if allocs > 0 {
+		t.Errorf("expected no allocations per event got %v", allocs)
+	}
+}
+
+func TestResyncAllocs(t *testing.T) {
+	v, _ := newVallox(nil, Config{})
+	for _, size := range []int{64, 1024} {
+		garbage := bytes.Repeat([]byte{0x02}, size)
+		allocs := testing.AllocsPerRun(10, func() {
+			feedBuffer(v, garbage)
+		})
+		if allocs > 0 {
+			t.Errorf("expected no allocations resyncing %d bytes got %v", size, allocs)
+		}
+	}
+}
+
+// BenchmarkResync streams bytes that never form a valid frame
+func BenchmarkResync(b *testing.B) {
+	for _, size := range []int{64, 1024} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			v, _ := newVallox(nil, Config{})
+			garbage := bytes.Repeat([]byte{0x02}, size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				feedBuffer(v, garbage)
+			}
+		})
+	}
+}
+
+// BenchmarkHandlePackage covers decoding and delivering a frame
+func BenchmarkHandlePackage(b *testing.B) {
+	v, _ := newVallox(nil, Config{})
+	pkgs := []valloxPackage{
+		{MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64, 0},
+		{MsgDomain, MsgMainboard1, MsgPanels, RegisterCurrentFanSpeed, FanSpeed3, 0},
+		{MsgDomain, MsgMainboard1, MsgPanels, RegisterRH1, 0x80, 0},
+		{MsgDomain, MsgMainboard1, MsgPanels, RegisterServiceCounter, 0x02, 0},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		handlePackage(&pkgs[i%len(pkgs)], v)
+		<-v.in
+	}
+}
+
+// BenchmarkHandleBufferFragmented feeds frames one byte at a time like a slow
+// serial read
+func BenchmarkHandleBufferFragmented(b *testing.B) {
+	v, _ := newVallox(nil, Config{})
+	frame := testFrame(MsgDomain, MsgMainboard1, MsgPanels, RegisterOutdoorTemp, 0x64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := range frame {
+			feedBuffer(v, frame[j:j+1])
+		}
+		<-v.in
+	}
+}
+
+// feedBuffer handles data as if it was read from the bus
+func feedBuffer(v *Vallox, data []byte) {
+	v.buffer.Write(data)
+	v.buffer.Writer.Flush()
+	handleBuffer(v)
+}
+
+// testFrame encodes a frame with a valid checksum
+func testFrame(system, source, destination, register, value byte) []byte {
+	frame := EncodeFrame(system, source, destination, register, value)
+	return frame[:]
+}
+
+// fakePort is an in-memory rs485 device
+type fakePort struct {
+	r       *io.PipeReader
+	w       *io.PipeWriter
+	mu      sync.Mutex
+	written bytes.Buffer
+}
+
+func newFakePort() *fakePort {
+	r, w := io.Pipe()
+	return &fakePort{r: r, w: w}
+}
+
+func (port *fakePort) Read(p []byte) (int, error) {
+	return port.r.Read(p)
+}
+
+func (port *fakePort) Write(p []byte) (int, error) {
+	port.mu.Lock()
+	defer port.mu.Unlock()
+	return port.written.Write(p)
+}
+
+func (port *fakePort) Close() error {
+	port.w.Close()
+	return port.r.Close()
+}
+
+// feed makes data available for reading from the port
+func (port *fakePort) feed(data []byte) {
+	go port.w.Write(data)
+}
+
+// fakeClock is a manually advanced clock for Vallox.now
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(v *Vallox) *fakeClock {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)}
+	v.now = clock.Now
+	return clock
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+}
@@ -0,0 +1,91 @@
+// Package valloxprom exports Vallox register values as Prometheus metrics
+package valloxprom
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	valloxrs485 "github.com/jokujossai/vallox-rs485"
+)
+
+var unitSuffix = map[string]string{
+	valloxrs485.UnitCelsius: "_celsius",
+	valloxrs485.UnitPercent: "_percent",
+	valloxrs485.UnitMinutes: "_minutes",
+	valloxrs485.UnitMonths:  "_months",
+}
+
+// Register registers a gauge for each numeric register, e.g.
+// vallox_outdoor_temp_celsius, and counters of the bus statistics on
+// registry. The gauges are updated on each event from vallox.
+func Register(vallox *valloxrs485.Vallox, registry *prometheus.Registry) error {
+	gauges := make(map[byte]prometheus.Gauge)
+	for register := 0; register <= 0xff; register++ {
+		info, ok := valloxrs485.LookupRegister(byte(register))
+		if !ok || info.Kind == valloxrs485.KindFlags {
+			continue
+		}
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "vallox_" + info.Name + unitSuffix[info.Unit],
+			Help: "Latest value of Vallox register " + strings.Replace(info.Name, "_", " ", -1),
+		})
+		if err := registry.Register(gauge); err != nil {
+			return err
+		}
+		gauges[byte(register)] = gauge
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(valloxrs485.Metrics) uint64
+	}{
+		{"vallox_frames_read_total", "Valid frames read from the bus", func(s valloxrs485.Metrics) uint64 { return s.FramesRead }},
+		{"vallox_checksum_errors_total", "Invalid frames read from the bus", func(s valloxrs485.Metrics) uint64 { return s.ChecksumErrors }},
+		{"vallox_bytes_discarded_total", "Bytes discarded while resynchronizing", func(s valloxrs485.Metrics) uint64 { return s.BytesDiscarded }},
+		{"vallox_events_delivered_total", "Events delivered to the Events channel", func(s valloxrs485.Metrics) uint64 { return s.EventsDelivered }},
+		{"vallox_events_dropped_total", "Events dropped because the Events channel was full", func(s valloxrs485.Metrics) uint64 { return s.EventsDropped }},
+		{"vallox_handler_events_dropped_total", "Events not passed to OnEvent handlers that did not keep up", func(s valloxrs485.Metrics) uint64 { return s.HandlerEventsDropped }},
+		{"vallox_subscriber_events_dropped_total", "Events dropped because a subscriber channel was full", func(s valloxrs485.Metrics) uint64 { return s.SubscriberEventsDropped }},
+		{"vallox_frames_sent_total", "Frames written to the bus", func(s valloxrs485.Metrics) uint64 { return s.FramesSent }},
+		{"vallox_write_delays_total", "Writes delayed by the write rate limit", func(s valloxrs485.Metrics) uint64 { return s.WriteDelays }},
+	}
+	for _, c := range counters {
+		value := c.value
+		counter := prometheus.NewCounterFunc(prometheus.CounterOpts{Name: c.name, Help: c.help}, func() float64 {
+			return float64(value(vallox.Metrics()))
+		})
+		if err := registry.Register(counter); err != nil {
+			return err
+		}
+	}
+
+	vallox.OnEvent(func(e valloxrs485.Event) {
+		gauge, ok := gauges[e.Register]
+		if !ok {
+			return
+		}
+		if value, ok := numericValue(e.Value); ok {
+			gauge.Set(value)
+		}
+	})
+	return nil
+}
+
+// numericValue converts a decoded event value to float64
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case valloxrs485.Temperature:
+		return float64(v.Celsius), !v.Fault
+	case valloxrs485.FanSpeed:
+		return float64(v), v.IsValid()
+	case float64:
+		return v, true
+	case int16:
+		return float64(v), true
+	case valloxrs485.Message:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,75 @@
+package valloxprom
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	valloxrs485 "github.com/jokujossai/vallox-rs485"
+)
+
+func TestRegister(t *testing.T) {
+	r, w := io.Pipe()
+	vallox, err := valloxrs485.Replay(r, valloxrs485.Config{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vallox.Close()
+	go func() {
+		for range vallox.Events() {
+		}
+	}()
+
+	registry := prometheus.NewRegistry()
+	if err := Register(vallox, registry); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := []byte{valloxrs485.MsgDomain, valloxrs485.MsgMainboard1, valloxrs485.MsgPanels, valloxrs485.RegisterCurrentFanSpeed, valloxrs485.FanSpeed3, 0}
+	for _, b := range frame[:5] {
+		frame[5] += b
+	}
+	record := make([]byte, 8, 14)
+	binary.BigEndian.PutUint64(record, uint64(time.Now().UnixNano()))
+	go w.Write(append(record, frame...))
+
+	deadline := time.Now().Add(time.Second)
+	for value, _ := metricValue(registry, "vallox_current_fan_speed"); value != 3; value, _ = metricValue(registry, "vallox_current_fan_speed") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected fan speed 3 got %v", value)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if value, _ := metricValue(registry, "vallox_frames_read_total"); value != 1 {
+		t.Errorf("expected 1 frame read got %v", value)
+	}
+	for _, name := range []string{"vallox_outdoor_temp_celsius", "vallox_rh1_percent", "vallox_checksum_errors_total"} {
+		if _, ok := metricValue(registry, name); !ok {
+			t.Errorf("expected metric %s", name)
+		}
+	}
+}
+
+// metricValue returns the value of gauge or counter name in registry
+func metricValue(registry *prometheus.Registry, name string) (float64, bool) {
+	families, _ := registry.Gather()
+	for _, family := range families {
+		if family.GetName() == name {
+			metric := family.GetMetric()[0]
+			return metric.GetGauge().GetValue() + metric.GetCounter().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+func TestNumericValue(t *testing.T) {
+	if _, ok := numericValue(valloxrs485.Temperature{Fault: true}); ok {
+		t.Errorf("faulty sensor should not update the gauge")
+	}
+	if v, ok := numericValue(int16(-5)); !ok || v != -5 {
+		t.Errorf("expected -5 got %v %v", v, ok)
+	}
+}